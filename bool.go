@@ -0,0 +1,25 @@
+package confl
+
+import "fmt"
+
+// boolWords maps the documented boolean words to their values
+var boolWords = map[string]bool{
+	"true":  true,
+	"false": false,
+	"TRUE":  true,
+	"FALSE": false,
+	"yes":   true,
+	"no":    false,
+}
+
+// Bool decodes a boolean node, or a word that's one of the documented boolean
+// words, into a bool
+func Bool(n Node) (bool, error) {
+	if n.Type() == BoolType || n.Type() == WordType {
+		if b, ok := boolWords[n.Value()]; ok {
+			return b, nil
+		}
+	}
+
+	return false, fmt.Errorf("Node is not a boolean: %s", n.Value())
+}
@@ -0,0 +1,30 @@
+package confl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBool(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     Node
+		expected bool
+		err      bool
+	}{
+		{"true", &valueNode{nodeType: BoolType, val: "true"}, true, false},
+		{"FALSE", &valueNode{nodeType: BoolType, val: "FALSE"}, false, false},
+		{"yes word", &valueNode{nodeType: WordType, val: "yes"}, true, false},
+		{"other word", &valueNode{nodeType: WordType, val: "yes_please"}, false, true},
+		{"string", &valueNode{nodeType: StringType, val: "true"}, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := Bool(test.node)
+			assert.Equal(t, test.err, err != nil)
+			assert.Equal(t, test.expected, b)
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/nalanj/confl"
+)
+
+// document is an open document along with its parsed CST
+type document struct {
+
+	// text is the text of the document
+	text string
+
+	// lineStarts are the byte offsets where each line starts
+	lineStarts []int
+
+	// cst is the parsed document, or nil if it failed to parse
+	cst *confl.CST
+
+	// err is the error from parsing the document, if any
+	err error
+}
+
+// newDocument parses text into a new document
+func newDocument(text string) *document {
+	doc := &document{text: text, lineStarts: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			doc.lineStarts = append(doc.lineStarts, i+1)
+		}
+	}
+
+	doc.cst, doc.err = confl.ParseCST(strings.NewReader(text))
+	return doc
+}
+
+// position converts a byte offset into an LSP position
+func (d *document) position(offset int) position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+
+	line := sort.SearchInts(d.lineStarts, offset+1) - 1
+	return position{
+		Line:      line,
+		Character: utf16Len(d.text[d.lineStarts[line]:offset]),
+	}
+}
+
+// offset converts an LSP position into a byte offset
+func (d *document) offset(pos position) int {
+	if pos.Line >= len(d.lineStarts) {
+		return len(d.text)
+	}
+
+	offset := d.lineStarts[pos.Line]
+	for chars := 0; chars < pos.Character && offset < len(d.text); {
+		r, w := utf8.DecodeRuneInString(d.text[offset:])
+		if r == '\n' {
+			break
+		}
+		chars += len(utf16.Encode([]rune{r}))
+		offset += w
+	}
+
+	return offset
+}
+
+// textRange returns the range between two byte offsets
+func (d *document) textRange(start, end int) textRange {
+	return textRange{Start: d.position(start), End: d.position(end)}
+}
+
+// diagnostics returns the diagnostics for the document at uri
+func (d *document) diagnostics(uri string) []diagnostic {
+	if d.err == nil {
+		return []diagnostic{}
+	}
+
+	diag := diagnostic{
+		Range:    d.textRange(0, 0),
+		Severity: severityError,
+		Source:   "confl",
+		Message:  d.err.Error(),
+	}
+
+	if parseErr, ok := d.err.(*confl.ParseError); ok {
+		diag.Range = d.charRange(parseErr.Offset())
+		diag.Code = string(parseErr.Code())
+
+		for _, loc := range parseErr.Related() {
+			diag.RelatedInformation = append(diag.RelatedInformation, relatedInformation{
+				Location: location{URI: uri, Range: d.charRange(loc.Offset)},
+				Message:  loc.Message,
+			})
+		}
+	}
+
+	return []diagnostic{diag}
+}
+
+// charRange returns the range of the character at offset, or an empty range
+// if that's the end of the line
+func (d *document) charRange(offset int) textRange {
+	end := offset
+	if end < len(d.text) && d.text[end] != '\n' {
+		_, w := utf8.DecodeRuneInString(d.text[end:])
+		end += w
+	}
+
+	return d.textRange(offset, end)
+}
+
+// symbols returns the document symbols for the keys of a map node
+func (d *document) symbols(n confl.Node) []documentSymbol {
+	symbols := []documentSymbol{}
+
+	for _, pair := range confl.KVPairs(n) {
+		keyStart, keyEnd, _ := d.cst.Span(pair.Key)
+		_, valEnd, _ := d.cst.Span(pair.Value)
+
+		name := pair.Key.Value()
+		if pair.Key.Decorator() != "" {
+			name = fmt.Sprintf("%s(%s)", pair.Key.Decorator(), name)
+		}
+
+		symbols = append(symbols, documentSymbol{
+			Name:           name,
+			Detail:         describe(pair.Value),
+			Kind:           symbolKind(pair.Value),
+			Range:          d.textRange(keyStart, valEnd),
+			SelectionRange: d.textRange(keyStart, keyEnd),
+			Children:       d.symbols(pair.Value),
+		})
+	}
+
+	return symbols
+}
+
+// foldingRanges returns the folding ranges for every map and list spanning
+// more than one line
+func (d *document) foldingRanges(n confl.Node, ranges []foldingRange) []foldingRange {
+	for _, child := range n.Children() {
+		if child.Type() != confl.MapType && child.Type() != confl.ListType {
+			continue
+		}
+
+		start, end, _ := d.cst.Span(child)
+		startLine, endLine := d.position(start).Line, d.position(end).Line
+		if endLine > startLine {
+			ranges = append(ranges, foldingRange{StartLine: startLine, EndLine: endLine})
+		}
+
+		ranges = d.foldingRanges(child, ranges)
+	}
+
+	return ranges
+}
+
+// nodeAt returns the innermost node within n containing the byte offset, or
+// nil if there's none
+func (d *document) nodeAt(n confl.Node, offset int) confl.Node {
+	for _, child := range n.Children() {
+		start, end, ok := d.cst.Span(child)
+		if ok && offset >= start && offset < end {
+			if inner := d.nodeAt(child, offset); inner != nil {
+				return inner
+			}
+			return child
+		}
+	}
+
+	return nil
+}
+
+// describe returns a short description of a node's type and decorator
+func describe(n confl.Node) string {
+	if n.Decorator() != "" {
+		return fmt.Sprintf("%s decorated with %s", n.Type(), n.Decorator())
+	}
+
+	return n.Type().String()
+}
+
+// symbolKind returns the LSP symbol kind for a node
+func symbolKind(n confl.Node) int {
+	switch n.Type() {
+	case confl.MapType:
+		return symbolKindObject
+	case confl.ListType:
+		return symbolKindArray
+	case confl.NumberType:
+		return symbolKindNumber
+	case confl.StringType:
+		return symbolKindString
+	case confl.NullType:
+		return symbolKindNull
+	case confl.BoolType:
+		return symbolKindBoolean
+	default:
+		return symbolKindConstant
+	}
+}
+
+// utf16Len returns the length of s in UTF-16 code units
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+
+	return n
+}
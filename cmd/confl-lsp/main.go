@@ -0,0 +1,21 @@
+/*
+Command confl-lsp is a Language Server Protocol server for confl files. It
+speaks LSP over stdin and stdout, so it can be used with any editor that
+supports language servers.
+
+The server publishes parse errors as diagnostics and supports document
+symbols, folding ranges, hover, and formatting.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if err := newServer(os.Stdin, os.Stdout).run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
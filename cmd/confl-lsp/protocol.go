@@ -0,0 +1,172 @@
+package main
+
+import "encoding/json"
+
+// message is an incoming JSON-RPC message, which is a request when it has an
+// ID and a notification otherwise
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+// notification is an outgoing JSON-RPC notification
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// response is an outgoing JSON-RPC response
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+// responseError is a JSON-RPC error
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	// codeMethodNotFound is the error code for unknown methods
+	codeMethodNotFound = -32601
+
+	// codeInvalidParams is the error code for params that can't be decoded
+	codeInvalidParams = -32602
+
+	// codeRequestFailed is the error code for requests that couldn't be
+	// completed
+	codeRequestFailed = -32803
+)
+
+// position is a zero based line and UTF-16 character offset in a document
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// textRange is a range within a document
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+// textDocumentIdentifier identifies a document
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// textDocumentItem is a document along with its text
+type textDocumentItem struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+// didOpenParams are the params for textDocument/didOpen
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+// didChangeParams are the params for textDocument/didChange. Only full
+// document syncing is supported, so each change holds the whole document.
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+// documentParams are params that only identify a document
+type documentParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+// positionParams are params for a position within a document
+type positionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+// diagnostic is a problem found in a document
+type diagnostic struct {
+	Range    textRange `json:"range"`
+	Severity int       `json:"severity"`
+	Code     string    `json:"code,omitempty"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+
+	RelatedInformation []relatedInformation `json:"relatedInformation,omitempty"`
+}
+
+// relatedInformation is another location related to a diagnostic
+type relatedInformation struct {
+	Location location `json:"location"`
+	Message  string   `json:"message"`
+}
+
+// location is a range within a document
+type location struct {
+	URI   string    `json:"uri"`
+	Range textRange `json:"range"`
+}
+
+// severityError is the diagnostic severity for errors
+const severityError = 1
+
+// publishDiagnosticsParams are the params for
+// textDocument/publishDiagnostics
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+// symbol kinds used for document symbols
+const (
+	symbolKindConstant = 14
+	symbolKindString   = 15
+	symbolKindNumber   = 16
+	symbolKindBoolean  = 17
+	symbolKindArray    = 18
+	symbolKindObject   = 19
+	symbolKindNull     = 21
+)
+
+// documentSymbol is a symbol within a document
+type documentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          textRange        `json:"range"`
+	SelectionRange textRange        `json:"selectionRange"`
+	Children       []documentSymbol `json:"children,omitempty"`
+}
+
+// foldingRange is a range of lines that can be folded
+type foldingRange struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// markupContent is formatted text
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// hover is the result of a hover request
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range    textRange     `json:"range"`
+}
+
+// textEdit is an edit to a document
+type textEdit struct {
+	Range   textRange `json:"range"`
+	NewText string    `json:"newText"`
+}
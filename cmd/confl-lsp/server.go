@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nalanj/confl"
+)
+
+// server is a language server speaking JSON-RPC over a reader and writer
+type server struct {
+
+	// in is the stream of incoming messages
+	in *bufio.Reader
+
+	// out is the stream for outgoing messages
+	out io.Writer
+
+	// outMu guards writes to out
+	outMu sync.Mutex
+
+	// docs are the open documents by URI
+	docs map[string]*document
+}
+
+// newServer returns a new server reading from r and writing to w
+func newServer(r io.Reader, w io.Writer) *server {
+	return &server{
+		in:   bufio.NewReader(r),
+		out:  w,
+		docs: make(map[string]*document),
+	}
+}
+
+// run handles messages until the client sends exit or closes the stream
+func (s *server) run() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, respErr := s.handle(msg)
+		if msg.ID == nil {
+			continue
+		}
+
+		if err := s.write(&response{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Result:  result,
+			Error:   respErr,
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// read reads the next message
+func (s *server) read() (*message, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("Illegal Content-Length header: %s", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// write writes a message
+func (s *server) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+
+	if _, err := fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = s.out.Write(body)
+	return err
+}
+
+// notify sends a notification to the client
+func (s *server) notify(method string, params interface{}) error {
+	return s.write(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle handles a single request or notification
+func (s *server) handle(msg *message) (interface{}, *responseError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1,
+				"documentSymbolProvider":     true,
+				"foldingRangeProvider":       true,
+				"hoverProvider":              true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "confl-lsp"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.open(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if len(params.ContentChanges) > 0 {
+			last := params.ContentChanges[len(params.ContentChanges)-1]
+			s.open(params.TextDocument.URI, last.Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []diagnostic{},
+		})
+		return nil, nil
+	case "textDocument/documentSymbol":
+		return s.withDocument(msg, func(doc *document) (interface{}, *responseError) {
+			return doc.symbols(doc.cst.Root()), nil
+		})
+	case "textDocument/foldingRange":
+		return s.withDocument(msg, func(doc *document) (interface{}, *responseError) {
+			return doc.foldingRanges(doc.cst.Root(), []foldingRange{}), nil
+		})
+	case "textDocument/hover":
+		var params positionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.withDocument(msg, func(doc *document) (interface{}, *responseError) {
+			node := doc.nodeAt(doc.cst.Root(), doc.offset(params.Position))
+			if node == nil {
+				return nil, nil
+			}
+
+			start, end, _ := doc.cst.Span(node)
+			return &hover{
+				Contents: markupContent{Kind: "markdown", Value: hoverText(node)},
+				Range:    doc.textRange(start, end),
+			}, nil
+		})
+	case "textDocument/formatting":
+		return s.withDocument(msg, func(doc *document) (interface{}, *responseError) {
+			formatted, err := confl.Format([]byte(doc.text))
+			if err != nil {
+				return nil, &responseError{Code: codeRequestFailed, Message: err.Error()}
+			}
+
+			return []textEdit{{
+				Range:   doc.textRange(0, len(doc.text)),
+				NewText: string(formatted),
+			}}, nil
+		})
+	default:
+		return nil, &responseError{
+			Code:    codeMethodNotFound,
+			Message: fmt.Sprintf("Unknown method %s", msg.Method),
+		}
+	}
+}
+
+// open parses and stores a document, then publishes its diagnostics
+func (s *server) open(uri, text string) {
+	doc := newDocument(text)
+	s.docs[uri] = doc
+	s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: doc.diagnostics(uri),
+	})
+}
+
+// withDocument calls fn with the document identified by the params of msg.
+// Documents that failed to parse have no results.
+func (s *server) withDocument(
+	msg *message,
+	fn func(doc *document) (interface{}, *responseError),
+) (interface{}, *responseError) {
+	var params documentParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, invalidParams(err)
+	}
+
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, &responseError{
+			Code:    codeRequestFailed,
+			Message: fmt.Sprintf("Unknown document %s", params.TextDocument.URI),
+		}
+	}
+	if doc.cst == nil {
+		return nil, nil
+	}
+
+	return fn(doc)
+}
+
+// hoverText returns the markdown shown when hovering over a node
+func hoverText(n confl.Node) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**", n.Type())
+	if n.Decorator() != "" {
+		fmt.Fprintf(&b, " decorated with `%s`", n.Decorator())
+	}
+
+	return b.String()
+}
+
+// invalidParams returns an error for params that couldn't be decoded
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
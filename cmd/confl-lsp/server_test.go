@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testClient is an in-process LSP client connected to a server
+type testClient struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	nextID int
+	done   chan error
+}
+
+// testMessage is any message the server sends
+type testMessage struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+func newTestClient(t *testing.T) *testClient {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	c := &testClient{t: t, w: clientW, r: bufio.NewReader(clientR), done: make(chan error)}
+	go func() {
+		c.done <- newServer(serverR, serverW).run()
+		serverW.Close()
+	}()
+
+	return c
+}
+
+func (c *testClient) send(msg map[string]interface{}) {
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	assert.Nil(c.t, err)
+
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	assert.Nil(c.t, err)
+}
+
+func (c *testClient) receive() *testMessage {
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	assert.Nil(c.t, err)
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	assert.Nil(c.t, err)
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(c.r, body)
+	assert.Nil(c.t, err)
+
+	var msg testMessage
+	assert.Nil(c.t, json.Unmarshal(body, &msg))
+	return &msg
+}
+
+func (c *testClient) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"method": method, "params": params})
+}
+
+func (c *testClient) request(method string, params interface{}, result interface{}) *responseError {
+	c.nextID++
+	c.send(map[string]interface{}{"id": c.nextID, "method": method, "params": params})
+
+	msg := c.receive()
+	assert.Equal(c.t, c.nextID, *msg.ID)
+	if msg.Error == nil && result != nil {
+		assert.Nil(c.t, json.Unmarshal(msg.Result, result))
+	}
+	return msg.Error
+}
+
+func (c *testClient) open(uri, text string) publishDiagnosticsParams {
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "version": 1, "text": text},
+	})
+
+	msg := c.receive()
+	assert.Equal(c.t, "textDocument/publishDiagnostics", msg.Method)
+
+	var params publishDiagnosticsParams
+	assert.Nil(c.t, json.Unmarshal(msg.Params, &params))
+	return params
+}
+
+func (c *testClient) close() {
+	assert.Nil(c.t, c.request("shutdown", nil, nil))
+	c.notify("exit", nil)
+	assert.Nil(c.t, <-c.done)
+}
+
+func docParams(uri string) map[string]interface{} {
+	return map[string]interface{}{"textDocument": map[string]string{"uri": uri}}
+}
+
+const testDoc = `# Simple wifi configuration
+device(wifi0)={
+  network="Pretty fly for a wifi"
+  dhcp=true
+
+  dns=[
+    "10.0.0.1"
+    "10.0.0.2"
+  ]
+  vpn={host="12.12.12.12" key=path("/etc/vpn.key")}
+}
+`
+
+func TestServerInitialize(t *testing.T) {
+	c := newTestClient(t)
+
+	var result struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	assert.Nil(t, c.request("initialize", map[string]interface{}{}, &result))
+	assert.Equal(t, true, result.Capabilities["documentSymbolProvider"])
+	assert.Equal(t, true, result.Capabilities["documentFormattingProvider"])
+
+	c.notify("initialized", map[string]interface{}{})
+	respErr := c.request("unknown/method", nil, nil)
+	assert.Equal(t, codeMethodNotFound, respErr.Code)
+
+	c.close()
+}
+
+func TestServerDiagnostics(t *testing.T) {
+	c := newTestClient(t)
+
+	diags := c.open("file:///test.confl", testDoc)
+	assert.Equal(t, []diagnostic{}, diags.Diagnostics)
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": "file:///test.confl", "version": 2},
+		"contentChanges": []map[string]string{{"text": "key=value\nother=]"}},
+	})
+	msg := c.receive()
+	var params publishDiagnosticsParams
+	assert.Nil(t, json.Unmarshal(msg.Params, &params))
+	assert.Equal(t, 1, len(params.Diagnostics))
+	assert.Equal(t, "file:///test.confl", params.URI)
+	assert.Equal(
+		t,
+		textRange{Start: position{Line: 1, Character: 6}, End: position{Line: 1, Character: 7}},
+		params.Diagnostics[0].Range,
+	)
+	assert.Equal(t, "unexpected_close", params.Diagnostics[0].Code)
+
+	diags = c.open("file:///unclosed.confl", "a=[1 2")
+	assert.Equal(t, "unclosed", diags.Diagnostics[0].Code)
+	assert.Equal(
+		t,
+		[]relatedInformation{{
+			Location: location{
+				URI:   "file:///unclosed.confl",
+				Range: textRange{Start: position{Line: 0, Character: 2}, End: position{Line: 0, Character: 3}},
+			},
+			Message: "`[` opened here",
+		}},
+		diags.Diagnostics[0].RelatedInformation,
+	)
+
+	c.close()
+}
+
+func TestServerDocumentSymbols(t *testing.T) {
+	c := newTestClient(t)
+	c.open("file:///test.confl", testDoc)
+
+	var symbols []documentSymbol
+	assert.Nil(t, c.request("textDocument/documentSymbol", docParams("file:///test.confl"), &symbols))
+
+	assert.Equal(t, 1, len(symbols))
+	assert.Equal(t, "device(wifi0)", symbols[0].Name)
+	assert.Equal(t, symbolKindObject, symbols[0].Kind)
+	assert.Equal(t, textRange{position{1, 0}, position{10, 1}}, symbols[0].Range)
+	assert.Equal(t, textRange{position{1, 0}, position{1, 13}}, symbols[0].SelectionRange)
+
+	names := []string{}
+	for _, child := range symbols[0].Children {
+		names = append(names, child.Name)
+	}
+	assert.Equal(t, []string{"network", "dhcp", "dns", "vpn"}, names)
+	assert.Equal(t, "map", symbols[0].Children[3].Detail)
+	assert.Equal(t, 2, len(symbols[0].Children[3].Children))
+
+	c.close()
+}
+
+func TestServerFoldingRanges(t *testing.T) {
+	c := newTestClient(t)
+	c.open("file:///test.confl", testDoc)
+
+	var ranges []foldingRange
+	assert.Nil(t, c.request("textDocument/foldingRange", docParams("file:///test.confl"), &ranges))
+	assert.Equal(t, []foldingRange{{StartLine: 1, EndLine: 10}, {StartLine: 5, EndLine: 8}}, ranges)
+
+	c.close()
+}
+
+func TestServerHover(t *testing.T) {
+	c := newTestClient(t)
+	c.open("file:///test.confl", testDoc)
+
+	hoverAt := func(line, character int) *hover {
+		params := docParams("file:///test.confl")
+		params["position"] = position{Line: line, Character: character}
+
+		var result *hover
+		assert.Nil(t, c.request("textDocument/hover", params, &result))
+		return result
+	}
+
+	result := hoverAt(9, 40)
+	assert.Equal(t, "**string** decorated with `path`", result.Contents.Value)
+	assert.Equal(t, textRange{position{9, 30}, position{9, 50}}, result.Range)
+
+	result = hoverAt(1, 8)
+	assert.Equal(t, "**word** decorated with `device`", result.Contents.Value)
+
+	result = hoverAt(1, 16)
+	assert.Equal(t, "**map**", result.Contents.Value)
+
+	assert.Nil(t, hoverAt(0, 3))
+
+	c.close()
+}
+
+func TestServerFormatting(t *testing.T) {
+	c := newTestClient(t)
+	c.open("file:///test.confl", "key = value   other={a=1\nb=2}")
+
+	var edits []textEdit
+	assert.Nil(t, c.request("textDocument/formatting", docParams("file:///test.confl"), &edits))
+	assert.Equal(t, 1, len(edits))
+	assert.Equal(t, "key=value\nother={\n  a=1\n  b=2\n}\n", edits[0].NewText)
+	assert.Equal(t, textRange{position{0, 0}, position{1, 4}}, edits[0].Range)
+
+	c.close()
+}
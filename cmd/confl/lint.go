@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/nalanj/confl"
+	"github.com/nalanj/confl/lint"
+)
+
+// lintResult is the machine-readable result for a single file
+type lintResult struct {
+	File   string       `json:"file"`
+	Error  string       `json:"error,omitempty"`
+	Line   int          `json:"line,omitempty"`
+	Column int          `json:"column,omitempty"`
+	Issues []lint.Issue `json:"issues"`
+}
+
+// runLint runs the lint command and returns the exit code, which is 1 if any
+// file had issues or failed to parse
+func runLint(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "path to the lint configuration (default .confllint)")
+	format := flags.String("format", "text", "output format, text or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "confl lint: unknown format %s\n", *format)
+		return 2
+	}
+
+	cfg, err := loadLintConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "confl lint: %s\n", err)
+		return 2
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	code := 0
+	results := []lintResult{}
+	for _, file := range files {
+		result := lintFile(file, stdin, cfg)
+		if result.Error != "" || len(result.Issues) > 0 {
+			code = 1
+		}
+		results = append(results, result)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(results)
+		return code
+	}
+
+	for _, result := range results {
+		if result.Line > 0 {
+			fmt.Fprintf(stdout, "%s:%d:%d: %s\n", result.File, result.Line, result.Column, result.Error)
+		} else if result.Error != "" {
+			fmt.Fprintf(stdout, "%s: %s\n", result.File, result.Error)
+		}
+		for _, issue := range result.Issues {
+			fmt.Fprintf(
+				stdout,
+				"%s:%d:%d: %s (%s)\n",
+				result.File, issue.Line, issue.Column, issue.Message, issue.Rule,
+			)
+		}
+	}
+
+	return code
+}
+
+// loadLintConfig loads the lint configuration from path, or from .confllint
+// if path is empty and that file exists
+func loadLintConfig(path string) (*lint.Config, error) {
+	if path == "" {
+		path = ".confllint"
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return lint.DefaultConfig(), nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, err := lint.LoadConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return cfg, nil
+}
+
+// lintFile lints a single file, where - is stdin
+func lintFile(file string, stdin io.Reader, cfg *lint.Config) lintResult {
+	result := lintResult{File: file, Issues: []lint.Issue{}}
+
+	var src []byte
+	var err error
+	if file == "-" {
+		src, err = ioutil.ReadAll(stdin)
+	} else {
+		src, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	issues, err := lint.Lint(src, cfg)
+	if err != nil {
+		result.Error = err.Error()
+		if parseErr, ok := err.(*confl.ParseError); ok {
+			result.Line, result.Column = parseErr.Line(), parseErr.Column()
+		}
+		return result
+	}
+
+	result.Issues = issues
+	return result
+}
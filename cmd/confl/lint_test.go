@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunLint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confl-lint")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "lint.confl")
+	assert.Nil(t, ioutil.WriteFile(config, []byte("disable=[quote_style]"), 0644))
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		output string
+	}{
+		{
+			"clean",
+			[]string{"lint"},
+			"key=value",
+			0,
+			"",
+		},
+		{
+			"text output",
+			[]string{"lint"},
+			"a=true\nb=FALSE",
+			1,
+			"-:2:3: Boolean FALSE is upper case, expected lower case (bool_case)\n",
+		},
+		{
+			"parse error",
+			[]string{"lint"},
+			"a=",
+			1,
+			"-:1:3: Illegal token, expected map value, got EOF\n",
+		},
+		{
+			"json output",
+			[]string{"lint", "-format", "json"},
+			"a='one' b=\"two\"",
+			1,
+			`[
+  {
+    "file": "-",
+    "issues": [
+      {
+        "rule": "quote_style",
+        "message": "String quoted with \", expected '",
+        "line": 1,
+        "column": 11
+      }
+    ]
+  }
+]
+`,
+		},
+		{
+			"config file",
+			[]string{"lint", "-config", config},
+			"a='one' b=\"two\"",
+			0,
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(test.args, strings.NewReader(test.stdin), &stdout, &stderr)
+			assert.Equal(t, test.code, code)
+			assert.Equal(t, test.output, stdout.String())
+		})
+	}
+}
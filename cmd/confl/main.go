@@ -0,0 +1,38 @@
+/*
+Command confl is a tool for working with confl files.
+
+Usage:
+
+	confl lint [-config file] [-format text|json] [files...]
+
+The lint command checks files with the rules from the lint package, reading
+standard input when no files are given. Rules are configured by a .confllint
+file in the current directory, or the file given with -config.
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command with args and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: confl <command> [arguments]")
+		return 2
+	}
+
+	switch args[0] {
+	case "lint":
+		return runLint(args[1:], stdin, stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "confl: unknown command %s\n", args[0])
+		return 2
+	}
+}
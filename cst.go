@@ -0,0 +1,240 @@
+package confl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// CSTTokenKind represents the kinds of tokens in a concrete syntax tree
+type CSTTokenKind int
+
+const (
+	// CSTSyntax is the kind for tokens that are part of the syntax of the
+	// document, such as words, strings and delimiters
+	CSTSyntax CSTTokenKind = iota
+
+	// CSTWhitespace is the kind for runs of whitespace
+	CSTWhitespace
+
+	// CSTComment is the kind for comments, not including the line break that
+	// ends them
+	CSTComment
+)
+
+// CSTToken is a single token out of a concrete syntax tree
+type CSTToken struct {
+
+	// Kind is the kind of the token
+	Kind CSTTokenKind
+
+	// Offset is the byte offset of the token in the source
+	Offset int
+
+	// Text is the exact source text of the token
+	Text string
+}
+
+// cstSpan is the span of a node as inclusive token indexes
+type cstSpan struct {
+
+	// start is the index of the first token of the node
+	start int
+
+	// end is the index of the last token of the node
+	end int
+
+	// value is the index of the token holding the value of a value node, or -1
+	// for maps and lists
+	value int
+}
+
+// cstRecorder records tokens and node spans while scanning and parsing
+type cstRecorder struct {
+	tokens []CSTToken
+	spans  map[Node]cstSpan
+}
+
+// record records a token of the given kind from start to the current offset
+func (s *scanner) record(kind CSTTokenKind, start int) {
+	if s.cst == nil {
+		return
+	}
+
+	s.cst.tokens = append(s.cst.tokens, CSTToken{
+		Kind:   kind,
+		Offset: start,
+		Text:   s.content(start, s.offset),
+	})
+}
+
+// tokenIndex returns the index of the most recently recorded token
+func (s *scanner) tokenIndex() int {
+	if s.cst == nil {
+		return -1
+	}
+
+	return len(s.cst.tokens) - 1
+}
+
+// markNode records the span of a node, from the token at start through the
+// most recently recorded token
+func (s *scanner) markNode(n Node, start int) {
+	if s.cst == nil || n == nil {
+		return
+	}
+
+	span, ok := s.cst.spans[n]
+	if !ok {
+		span.value = -1
+		if n.Type() != MapType && n.Type() != ListType {
+			span.value = start
+		}
+	}
+
+	span.start = start
+	span.end = len(s.cst.tokens) - 1
+	s.cst.spans[n] = span
+}
+
+// CST is a concrete syntax tree. It keeps every token, whitespace run and
+// comment of a document alongside the parsed Node tree, so printing an
+// unmodified CST reproduces the source exactly.
+type CST struct {
+	root   Node
+	tokens []CSTToken
+	spans  map[Node]cstSpan
+}
+
+// ParseCST scans and parses a document from a reader, keeping everything
+// needed to print it back byte for byte
+func ParseCST(r io.Reader) (*CST, error) {
+	src, readErr := ioutil.ReadAll(r)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return parseCST(src)
+}
+
+// parseCST parses src into a CST
+func parseCST(src []byte) (*CST, error) {
+	scan := newScanner(src)
+	scan.cst = &cstRecorder{spans: make(map[Node]cstSpan)}
+
+	root, err := parseMap(scan, eofToken, "")
+	if err != nil {
+		return nil, err
+	}
+	scan.markNode(root, 0)
+
+	return &CST{root: root, tokens: scan.cst.tokens, spans: scan.cst.spans}, nil
+}
+
+// Root returns the root node of the document. Nodes returned from Root are
+// only valid for the CST until the next edit.
+func (c *CST) Root() Node {
+	return c.root
+}
+
+// Tokens returns every token in the document in order, including whitespace
+// and comments
+func (c *CST) Tokens() []CSTToken {
+	return c.tokens
+}
+
+// Bytes returns the source of the document
+func (c *CST) Bytes() []byte {
+	var buf bytes.Buffer
+	c.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// String returns the source of the document
+func (c *CST) String() string {
+	return string(c.Bytes())
+}
+
+// WriteTo writes the source of the document to w
+func (c *CST) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, tok := range c.tokens {
+		n, err := io.WriteString(w, tok.Text)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// Span returns the byte offsets of the source for a node, from the start of
+// its decorator, if any, through the end of the node. The node must come from
+// the current Root of the CST.
+func (c *CST) Span(n Node) (start int, end int, ok bool) {
+	span, ok := c.spans[n]
+	if !ok || span.end < span.start {
+		return 0, 0, false
+	}
+
+	last := c.tokens[span.end]
+	return c.tokens[span.start].Offset, last.Offset + len(last.Text), true
+}
+
+// settableTokens are the tokens that SetValue accepts as a value
+var settableTokens = map[tokenType]bool{
+	wordToken:     true,
+	stringToken:   true,
+	numberToken:   true,
+	sizeToken:     true,
+	durationToken: true,
+	dateToken:     true,
+	timeToken:     true,
+	dateTimeToken: true,
+}
+
+// SetValue replaces the source text of a value or null node with text, which
+// must be a single word, string, number, size, duration, date, or time in
+// confl syntax, such as `false`, `"new value"`, `45s`, or `2020-01-01`.
+// Decorators, whitespace and comments around the value are kept as they are.
+// After a successful edit the CST has a new Root, and nodes from the previous
+// Root are no longer valid.
+func (c *CST) SetValue(n Node, text string) error {
+	span, ok := c.spans[n]
+	if !ok || span.value < 0 {
+		return fmt.Errorf("Node is not a value node in this CST")
+	}
+
+	scan := newScanner([]byte(text))
+	tok := scan.Token()
+	if !settableTokens[tok.Type] ||
+		tok.Offset != 0 ||
+		scan.offset != len(text) {
+		return fmt.Errorf("Illegal value %s", text)
+	}
+
+	tokens := append([]CSTToken{}, c.tokens...)
+	tokens[span.value].Text = text
+
+	// null() is the only value spread across tokens, so drop the rest of it
+	if n.Type() == NullType {
+		for i := span.value + 1; i <= span.end; i++ {
+			tokens[i].Text = ""
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, tok := range tokens {
+		buf.WriteString(tok.Text)
+	}
+
+	edited, err := parseCST(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	*c = *edited
+	return nil
+}
@@ -0,0 +1,279 @@
+package confl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ApplyPatch applies a patch, in the form taken by the ApplyPatch function,
+// by editing the source of the document, so everything the patch doesn't
+// touch stays byte for byte the same, comments included. Added and replaced
+// values are written on a single line, while moved and copied values keep
+// their source. A key added to a map spread over several lines goes on its
+// own line, indented like the key before it.
+//
+// If any operation fails no changes are made. After a successful patch the
+// CST has a new Root, and nodes from the previous Root are no longer valid.
+func (c *CST) ApplyPatch(patch Node) error {
+	ops, err := parsePatch(patch)
+	if err != nil {
+		return err
+	}
+
+	// applying the patch to the tree first checks every operation, and gives
+	// the document the edited source has to parse to
+	expected, err := ApplyPatch(c.root, patch)
+	if err != nil {
+		return err
+	}
+
+	edited := c
+	for i, op := range ops {
+		src, err := edited.patchSource(op)
+		if err == nil {
+			edited, err = parseCST(src)
+		}
+		if err != nil {
+			return fmt.Errorf("Patch operation %d (%s): %s", i, op.op, err)
+		}
+	}
+
+	if !nodesEqual(expected, edited.root) {
+		return fmt.Errorf("Patch can't be applied to the source of the document")
+	}
+
+	*c = *edited
+	return nil
+}
+
+// patchSource returns the source of the document with an operation applied
+func (c *CST) patchSource(op *patchOp) ([]byte, error) {
+	switch op.op {
+	case "add":
+		return c.addSource(op.path, op.value, formatNode(op.value))
+	case "remove":
+		return c.removeSource(op.path)
+	case "replace":
+		return c.replaceSource(op.path, op.value, formatNode(op.value))
+	case "move":
+		val, err := patchGet(c.root, op.from)
+		if err != nil {
+			return nil, err
+		}
+		text := c.source(val)
+
+		src, err := c.removeSource(op.from)
+		if err != nil {
+			return nil, err
+		}
+		removed, err := parseCST(src)
+		if err != nil {
+			return nil, err
+		}
+		return removed.addSource(op.path, val, text)
+	case "copy":
+		val, err := patchGet(c.root, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return c.addSource(op.path, val, c.source(val))
+	default:
+		return c.Bytes(), nil
+	}
+}
+
+// addSource returns the source with val, written as text, added at path
+func (c *CST) addSource(path []mapKey, val Node, text string) ([]byte, error) {
+	if len(path) == 0 {
+		return c.replaceSource(path, val, text)
+	}
+
+	parent, err := patchGet(c.root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	seg := path[len(path)-1]
+
+	if parent.Type() == MapType {
+		if keyIndex(parent, seg) >= 0 {
+			return c.replaceSource(path, val, text)
+		}
+		return c.insertSource(parent, len(parent.Children()), formatNode(newKeyNode(seg))+"="+text), nil
+	}
+
+	i := len(parent.Children())
+	if seg != (mapKey{value: "-"}) {
+		if i, err = listIndex(parent, seg, true); err != nil {
+			return nil, err
+		}
+	}
+	return c.insertSource(parent, i, text), nil
+}
+
+// replaceSource returns the source with the node at path replaced by val,
+// written as text
+func (c *CST) replaceSource(path []mapKey, val Node, text string) ([]byte, error) {
+	if len(path) == 0 {
+		if val.Type() != MapType || val.Decorator() != "" {
+			return nil, fmt.Errorf("Cannot replace the document with anything but a map")
+		}
+		return []byte(formatDocument(val)), nil
+	}
+
+	n, err := patchGet(c.root, path)
+	if err != nil {
+		return nil, err
+	}
+
+	span := c.spans[n]
+	return c.splice(span.start, span.end+1, text), nil
+}
+
+// removeSource returns the source with the node at path removed, along with
+// its key in a map, a comment on the rest of its line, and the line itself if
+// nothing else is on it
+func (c *CST) removeSource(path []mapKey) ([]byte, error) {
+	parent, err := patchGet(c.root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	seg := path[len(path)-1]
+
+	var start, end int
+	if parent.Type() == MapType {
+		i := keyIndex(parent, seg)
+		start, end = c.spans[parent.Children()[i-1]].start, c.spans[parent.Children()[i]].end
+	} else {
+		i, err := listIndex(parent, seg, false)
+		if err != nil {
+			return nil, err
+		}
+		span := c.spans[parent.Children()[i]]
+		start, end = span.start, span.end
+	}
+	end = c.lineEnd(end)
+
+	// tidy up the whitespace on either side so the neighbours keep their
+	// layout
+	prev, next := "", ""
+	if c.isWhitespace(start - 1) {
+		start--
+		prev = c.tokens[start].Text
+	}
+	if c.isWhitespace(end + 1) {
+		end++
+		next = c.tokens[end].Text
+	}
+
+	var text string
+	switch {
+	case strings.Contains(prev, "\n") && strings.Contains(next, "\n"):
+		text = prev[:strings.LastIndex(prev, "\n")+1] + next[strings.Index(next, "\n")+1:]
+	case strings.Contains(prev, "\n") && next == "" && end+1 == len(c.tokens):
+		text = prev[:strings.LastIndex(prev, "\n")+1]
+	case strings.Contains(prev, "\n"):
+		text = prev + strings.TrimLeft(next, " \t")
+	case prev != "":
+		text = next
+	case strings.Contains(next, "\n"):
+		text = next[strings.Index(next, "\n")+1:]
+	}
+
+	return c.splice(start, end+1, text), nil
+}
+
+// insertSource returns the source with text inserted into a map or list
+// before the child at i, or at the end if i is the number of children
+func (c *CST) insertSource(parent Node, i int, text string) []byte {
+	children := parent.Children()
+	step := 1
+	if parent.Type() == MapType {
+		step = 2
+	}
+
+	// an empty map or list gets the text alone
+	if len(children) == 0 {
+		if parent == c.root {
+			src := c.Bytes()
+			if len(src) > 0 && src[len(src)-1] != '\n' {
+				text = "\n" + text
+			}
+			return append(src, text+"\n"...)
+		}
+
+		open := c.spans[parent].start
+		for c.tokens[open].Text != "{" && c.tokens[open].Text != "[" {
+			open++
+		}
+		return c.splice(open+1, open+1, text)
+	}
+
+	// the text takes the place of the item it's inserted before, or follows
+	// the last item, separated the same way as that item
+	item := i
+	if i == len(children) {
+		item = i - step
+	}
+	sep := " "
+	if start := c.spans[children[item]].start; parent == c.root || c.isWhitespace(start-1) &&
+		strings.Contains(c.tokens[start-1].Text, "\n") {
+		sep = "\n"
+		if c.isWhitespace(start - 1) {
+			ws := c.tokens[start-1].Text
+			sep += ws[strings.LastIndex(ws, "\n")+1:]
+		}
+	}
+
+	if i == len(children) {
+		end := c.lineEnd(c.spans[children[i-1]].end)
+		return c.splice(end+1, end+1, sep+text)
+	}
+
+	start := c.spans[children[i]].start
+	return c.splice(start, start, text+sep)
+}
+
+// lineEnd returns the index of the comment following the token at i on the
+// same line, if there is one, and i otherwise
+func (c *CST) lineEnd(i int) int {
+	next := i + 1
+	if c.isWhitespace(next) && !strings.Contains(c.tokens[next].Text, "\n") {
+		next++
+	}
+	if next < len(c.tokens) && c.tokens[next].Kind == CSTComment {
+		return next
+	}
+
+	return i
+}
+
+// isWhitespace returns whether there's a whitespace token at i
+func (c *CST) isWhitespace(i int) bool {
+	return i >= 0 && i < len(c.tokens) && c.tokens[i].Kind == CSTWhitespace
+}
+
+// source returns the source text of a node
+func (c *CST) source(n Node) string {
+	var b strings.Builder
+	span := c.spans[n]
+	for _, tok := range c.tokens[span.start : span.end+1] {
+		b.WriteString(tok.Text)
+	}
+
+	return b.String()
+}
+
+// splice returns the source with the tokens from start up to end replaced by
+// text
+func (c *CST) splice(start, end int, text string) []byte {
+	var b strings.Builder
+	for _, tok := range c.tokens[:start] {
+		b.WriteString(tok.Text)
+	}
+	b.WriteString(text)
+	for _, tok := range c.tokens[end:] {
+		b.WriteString(tok.Text)
+	}
+
+	return []byte(b.String())
+}
@@ -0,0 +1,106 @@
+package confl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSTApplyPatch(t *testing.T) {
+	src := `# wifi settings
+device(wifi0)={
+  network="Pretty fly for a wifi"  # the ssid
+  dhcp=true
+
+  dns=["10.0.0.1" "10.0.0.2"]
+  gateway="10.0.0.1"
+}
+inline={a=1 b=2}
+`
+
+	tests := []struct {
+		name   string
+		patch  string
+		result string
+	}{
+		{
+			"replace a value",
+			`[{op=replace path="/device(wifi0)/network" value="Another wifi"}]`,
+			strings.Replace(src, `"Pretty fly for a wifi"`, `"Another wifi"`, 1),
+		},
+		{
+			"add a key to a multi-line map",
+			`[{op=add path="/device(wifi0)/key" value=path("/etc/vpn.key")}]`,
+			strings.Replace(src, "gateway=\"10.0.0.1\"\n", "gateway=\"10.0.0.1\"\n  key=path(\"/etc/vpn.key\")\n", 1),
+		},
+		{
+			"add a key to a single line map",
+			`[{op=add path="/inline/c" value="x y"}]`,
+			strings.Replace(src, "{a=1 b=2}", `{a=1 b=2 c="x y"}`, 1),
+		},
+		{
+			"add a key to the document",
+			`[{op=add path="/host" value={name=mail}}]`,
+			src + "host={name=mail}\n",
+		},
+		{
+			"insert into and append to a list",
+			`[
+				{op=add path="/device(wifi0)/dns/0" value="10.0.0.3"}
+				{op=add path="/device(wifi0)/dns/-" value="10.0.0.4"}
+			]`,
+			strings.Replace(src, `["10.0.0.1" "10.0.0.2"]`, `["10.0.0.3" "10.0.0.1" "10.0.0.2" "10.0.0.4"]`, 1),
+		},
+		{
+			"remove a key on its own line",
+			`[{op=remove path="/device(wifi0)/network"}]`,
+			strings.Replace(src, "  network=\"Pretty fly for a wifi\"  # the ssid\n", "", 1),
+		},
+		{
+			"remove keys and list items on a line",
+			`[
+				{op=remove path="/inline/a"}
+				{op=remove path="/device(wifi0)/dns/1"}
+			]`,
+			strings.Replace(strings.Replace(src, "{a=1 b=2}", "{b=2}", 1), ` "10.0.0.2"`, "", 1),
+		},
+		{
+			"move a value keeps its source",
+			`[{op=move from="/device(wifi0)/dns" path="/dns"}]`,
+			strings.Replace(src, "\n  dns=[\"10.0.0.1\" \"10.0.0.2\"]\n", "\n", 1) + "dns=[\"10.0.0.1\" \"10.0.0.2\"]\n",
+		},
+		{
+			"test",
+			`[{op=test path="/inline/b" value=2}]`,
+			src,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cst, err := ParseCST(strings.NewReader(src))
+			assert.Nil(t, err)
+
+			patch, err := Parse(strings.NewReader("patch=" + test.patch))
+			assert.Nil(t, err)
+
+			assert.Nil(t, cst.ApplyPatch(patch))
+			assert.Equal(t, test.result, cst.String())
+		})
+	}
+}
+
+func TestCSTApplyPatchFails(t *testing.T) {
+	src := "a=1 # one\nb=2\n"
+	cst, err := ParseCST(strings.NewReader(src))
+	assert.Nil(t, err)
+
+	patch, err := Parse(strings.NewReader(`patch=[{op=remove path="/a"} {op=remove path="/c"}]`))
+	assert.Nil(t, err)
+
+	// nothing changes when an operation fails
+	err = cst.ApplyPatch(patch)
+	assert.Equal(t, "Patch operation 1 (remove): Key c not found", err.Error())
+	assert.Equal(t, src, cst.String())
+}
@@ -0,0 +1,111 @@
+package confl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSTRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"empty document", ``},
+		{"only whitespace", " \n\t\n"},
+		{"simple map", `test=23 "also"=this`},
+		{"comment at end without newline", "key=value # trailing"},
+		{
+			"complex example",
+			`
+			# Simple wifi configuration
+			device(wifi0)={
+				network="Pretty fly for a wifi"
+				key='Some \'long\' wpa key'
+				dhcp=true
+
+				dns=[ "10.0.0.1"   "10.0.0.2" ]
+				gateway="10.0.0.1"  # the router
+
+				vpn={host="12.12.12.12" user=frank pass=secret key=path("/etc/vpn.key")}
+			}
+			`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cst, err := ParseCST(strings.NewReader(test.src))
+			assert.Nil(t, err)
+			assert.Equal(t, test.src, cst.String())
+		})
+	}
+}
+
+func TestCSTSetValue(t *testing.T) {
+	src := "# wifi\ndevice(wifi0)={\n  dhcp=true   # use dhcp\n  key=path(\"/etc/vpn.key\")\n}\n"
+
+	cst, err := ParseCST(strings.NewReader(src))
+	assert.Nil(t, err)
+
+	device := KVPairs(cst.Root())[0].Value
+	dhcp := KVPairs(device)[0].Value
+	assert.Nil(t, cst.SetValue(dhcp, "false"))
+	assert.Equal(
+		t,
+		"# wifi\ndevice(wifi0)={\n  dhcp=false   # use dhcp\n  key=path(\"/etc/vpn.key\")\n}\n",
+		cst.String(),
+	)
+
+	device = KVPairs(cst.Root())[0].Value
+	key := KVPairs(device)[1].Value
+	assert.Nil(t, cst.SetValue(key, `"/etc/other.key"`))
+	assert.Equal(
+		t,
+		"# wifi\ndevice(wifi0)={\n  dhcp=false   # use dhcp\n  key=path(\"/etc/other.key\")\n}\n",
+		cst.String(),
+	)
+	assert.Equal(t, "path", KVPairs(KVPairs(cst.Root())[0].Value)[1].Value.Decorator())
+
+	cst, err = ParseCST(strings.NewReader("key=null() # unset"))
+	assert.Nil(t, err)
+	assert.Nil(t, cst.SetValue(KVPairs(cst.Root())[0].Value, "12"))
+	assert.Equal(t, "key=12 # unset", cst.String())
+
+	cst, err = ParseCST(strings.NewReader("timeout=30s buffer=1MiB"))
+	assert.Nil(t, err)
+	assert.Nil(t, cst.SetValue(KVPairs(cst.Root())[0].Value, "45s"))
+	assert.Nil(t, cst.SetValue(KVPairs(cst.Root())[1].Value, "2MiB"))
+	assert.Equal(t, "timeout=45s buffer=2MiB", cst.String())
+	assert.Equal(t, DurationType, KVPairs(cst.Root())[0].Value.Type())
+
+	cst, err = ParseCST(strings.NewReader("expires=2019-05-01 at=10:30:00 renewed=2019-05-01T10:30:00Z"))
+	assert.Nil(t, err)
+	assert.Nil(t, cst.SetValue(KVPairs(cst.Root())[0].Value, "2020-01-01"))
+	assert.Nil(t, cst.SetValue(KVPairs(cst.Root())[1].Value, "11:00:00"))
+	assert.Nil(t, cst.SetValue(KVPairs(cst.Root())[2].Value, "2020-01-01T00:00:00Z"))
+	assert.Equal(t, "expires=2020-01-01 at=11:00:00 renewed=2020-01-01T00:00:00Z", cst.String())
+	assert.Equal(t, DateType, KVPairs(cst.Root())[0].Value.Type())
+
+	assert.NotNil(t, cst.SetValue(cst.Root(), "value"))
+	assert.NotNil(t, cst.SetValue(KVPairs(cst.Root())[0].Key, "two words"))
+	assert.NotNil(t, cst.SetValue(KVPairs(cst.Root())[0].Key, "12"))
+}
+
+func TestCSTSpan(t *testing.T) {
+	src := `key=dec({a=[1 2]})`
+
+	cst, err := ParseCST(strings.NewReader(src))
+	assert.Nil(t, err)
+
+	val := KVPairs(cst.Root())[0].Value
+	start, end, ok := cst.Span(val)
+	assert.True(t, ok)
+	assert.Equal(t, `dec({a=[1 2]})`, src[start:end])
+
+	list := KVPairs(val)[0].Value
+	start, end, ok = cst.Span(list)
+	assert.True(t, ok)
+	assert.Equal(t, `[1 2]`, src[start:end])
+}
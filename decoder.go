@@ -0,0 +1,138 @@
+package confl
+
+import (
+	"fmt"
+	"io"
+)
+
+// Decoder parses a stream of documents separated by `---` lines, which may
+// only have whitespace or a comment after the `---`, like:
+//
+//	host=mail.confl.org
+//	---
+//	host=web.confl.org
+//
+// Empty documents are skipped, so a stream may also start or end with a
+// separator.
+type Decoder struct {
+
+	// r is the reader the stream is read from
+	r io.Reader
+
+	// opts are the options for parsing each document
+	opts Options
+
+	// scan is the scanner for the stream, or nil if it hasn't been read yet
+	scan *scanner
+
+	// err is the error from reading the stream, if any
+	err error
+
+	// reported notes that err was returned from Next
+	reported bool
+
+	// doc is the number of documents parsed so far
+	doc int
+}
+
+// NewDecoder returns a new decoder that reads documents from r
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderWithOptions(r, Options{})
+}
+
+// NewDecoderWithOptions returns a new decoder that reads documents from r and
+// parses each using the given options. MaxSize limits the size of each
+// document rather than the whole stream.
+func NewDecoderWithOptions(r io.Reader, opts Options) *Decoder {
+	return &Decoder{r: r, opts: opts}
+}
+
+// More returns whether there's another document in the stream. The stream is
+// read only as far as the start of the next document, so More doesn't wait
+// for the rest of a stream that's still being written.
+func (d *Decoder) More() bool {
+	if !d.read() {
+		return !d.reported
+	}
+
+	return d.scan.skipSeparators() || d.scan.readErr != nil
+}
+
+// Next parses and returns the next document in the stream, or io.EOF when
+// there are none left. Each document is read from the stream as it's parsed.
+// A ParseError notes which document in the stream it happened in, and the
+// decoder skips to the next document after one.
+func (d *Decoder) Next() (Node, error) {
+	more := d.More()
+	if !d.read() {
+		d.reported = true
+		return nil, d.err
+	}
+	if !more {
+		return nil, io.EOF
+	}
+
+	d.doc++
+	d.scan.opens = nil
+
+	start := d.scan.base + d.scan.offset
+	if d.opts.MaxSize > 0 {
+		d.scan.limit = start + d.opts.MaxSize + 1
+	}
+
+	var node Node
+	var err error
+	if !d.opts.AnyRoot || isImplicitMap(d.scan) {
+		node, err = parseMap(d.scan, eofToken, "")
+	} else {
+		node, err = parseRootValue(d.scan)
+	}
+
+	end := d.scan.base + d.scan.offset
+	if d.scan.atSeparator() {
+		end = d.scan.base + d.scan.lineStart
+	}
+	if d.opts.MaxSize > 0 && end-start > d.opts.MaxSize {
+		err = newParseError(
+			ErrTooLarge,
+			fmt.Sprintf("Document is larger than the maximum of %d bytes", d.opts.MaxSize),
+			d.scan,
+			start+d.opts.MaxSize,
+			0,
+		)
+	}
+	d.scan.limit = 0
+
+	// carry on reading after stopping at the limit
+	if d.scan.ch == runeEOF {
+		d.scan.next()
+	}
+
+	if !d.read() {
+		d.reported = true
+		return nil, d.err
+	}
+
+	if parseErr, ok := err.(*ParseError); ok {
+		parseErr.document = d.doc
+		d.scan.skipDocument()
+		return nil, parseErr
+	}
+
+	return node, err
+}
+
+// read starts reading the stream the first time it's called, and returns
+// whether the stream has been read without an error so far
+func (d *Decoder) read() bool {
+	if d.scan == nil {
+		d.scan = newReaderScanner(d.r)
+		d.scan.opts = d.opts
+		d.scan.documents = true
+	}
+	if d.err == nil {
+		d.err = d.scan.readErr
+	}
+
+	return d.err == nil
+}
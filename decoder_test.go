@@ -0,0 +1,156 @@
+package confl
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecoder(t *testing.T) {
+	src := "---\nhost=mail\n---\n\n---\nhost=web # the web server\n---\n"
+	dec := NewDecoder(strings.NewReader(src))
+
+	hosts := []string{}
+	for dec.More() {
+		doc, err := dec.Next()
+		assert.Nil(t, err)
+
+		host, _ := mapValue(doc, "host")
+		hosts = append(hosts, host.Value())
+	}
+	assert.Equal(t, []string{"mail", "web"}, hosts)
+
+	_, err := dec.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDecoderErrors(t *testing.T) {
+	src := "a=1\n---\nb={c=1\n---\nd=2\n---\ne=] f=3\n---\ng=4"
+	dec := NewDecoderWithOptions(strings.NewReader(src), Options{Filename: "stream.confl"})
+
+	tests := []struct {
+		key      string
+		document int
+		line     int
+	}{
+		{"a", 0, 0},
+		{"", 2, 4},
+		{"d", 0, 0},
+		{"", 4, 7},
+		{"g", 0, 0},
+	}
+
+	for _, test := range tests {
+		assert.True(t, dec.More())
+
+		doc, err := dec.Next()
+		if test.key != "" {
+			assert.Nil(t, err)
+			assert.Equal(t, test.key, doc.Children()[0].Value())
+			continue
+		}
+
+		parseErr := err.(*ParseError)
+		assert.Equal(t, test.document, parseErr.Document())
+		assert.Equal(t, test.line, parseErr.Line())
+		assert.Contains(t, parseErr.FormatCode(CodeOptions{}), fmt.Sprintf(":%d:", test.line))
+	}
+	assert.False(t, dec.More())
+}
+
+func TestDecoderAnyRoot(t *testing.T) {
+	dec := NewDecoderWithOptions(strings.NewReader("[1 2]\n---\na=1\n---\ndec(3)"), Options{AnyRoot: true})
+
+	types := []NodeType{}
+	for dec.More() {
+		doc, err := dec.Next()
+		assert.Nil(t, err)
+		types = append(types, doc.Type())
+	}
+	assert.Equal(t, []NodeType{ListType, MapType, NumberType}, types)
+}
+
+func TestParseSeparator(t *testing.T) {
+	_, err := Parse(strings.NewReader("a=1\n---\nb=2"))
+	assert.Equal(t, "use a Decoder to parse a stream of documents", err.(*ParseError).Suggestion())
+
+	// separators only start at the beginning of a line
+	_, err = Parse(strings.NewReader("a=1 ---"))
+	assert.Equal(t, ErrIllegalToken, err.(*ParseError).Code())
+
+	// and have nothing but whitespace or a comment after them
+	for _, src := range []string{"a=1\n----\nb=2", "a=1\n---foo\nb=2", "a=1\n--- b=2"} {
+		_, err = Parse(strings.NewReader(src))
+		assert.Equal(t, ErrIllegalToken, err.(*ParseError).Code(), src)
+		assert.NotEqual(t, "use a Decoder to parse a stream of documents", err.(*ParseError).Suggestion(), src)
+	}
+}
+
+func TestDecoderSeparatorLines(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("a=1\n---  # the next one\nb=2\n--- \t\nc=3\n---foo\nd=4"))
+
+	keys := []string{}
+	for dec.More() {
+		doc, err := dec.Next()
+		if err != nil {
+			assert.Equal(t, 3, err.(*ParseError).Document())
+			assert.Equal(t, 6, err.(*ParseError).Line())
+			continue
+		}
+		keys = append(keys, doc.Children()[0].Value())
+	}
+	assert.Equal(t, []string{"a", "b"}, keys)
+}
+
+func TestDecoderPipe(t *testing.T) {
+	r, w := io.Pipe()
+	written := make(chan bool)
+	go func() {
+		fmt.Fprint(w, "host=mail\n---\n")
+		<-written
+		fmt.Fprint(w, "host=web\n")
+		w.Close()
+	}()
+
+	// the first document is decoded while the stream is still open
+	dec := NewDecoder(r)
+	assert.True(t, dec.More())
+	doc, err := dec.Next()
+	assert.Nil(t, err)
+	host, _ := mapValue(doc, "host")
+	assert.Equal(t, "mail", host.Value())
+
+	close(written)
+	doc, err = dec.Next()
+	assert.Nil(t, err)
+	host, _ = mapValue(doc, "host")
+	assert.Equal(t, "web", host.Value())
+	assert.False(t, dec.More())
+}
+
+func TestDecoderMaxSize(t *testing.T) {
+	// the second document fits in the first read, or goes on well past it
+	for _, size := range []int{100, 10000} {
+		src := "a=1\n---\nb=\"" + strings.Repeat("x", size) + "\"\n---\nc=2\n---\nd=3\n"
+		dec := NewDecoderWithOptions(strings.NewReader(src), Options{MaxSize: 20})
+
+		keys := []string{}
+		for dec.More() {
+			doc, err := dec.Next()
+			if err != nil {
+				parseErr := err.(*ParseError)
+				assert.Equal(t, ErrTooLarge, parseErr.Code())
+				assert.Equal(t, 2, parseErr.Document())
+				keys = append(keys, "")
+				continue
+			}
+			keys = append(keys, doc.Children()[0].Value())
+		}
+
+		// each document is limited rather than the whole stream
+		assert.Equal(t, []string{"a", "", "c", "d"}, keys)
+	}
+}
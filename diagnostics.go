@@ -0,0 +1,206 @@
+package confl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// sarifSchema is the schema of the SARIF logs written by WriteSARIF
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// WriteError writes err to w. A ParseError is rendered with FormatCode, in
+// color if w is a terminal, and any other error is written as its message.
+func WriteError(w io.Writer, err error) error {
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		_, werr := fmt.Fprintf(w, "error: %s\n", err)
+		return werr
+	}
+
+	_, werr := io.WriteString(w, parseErr.FormatCode(CodeOptions{Color: isTerminal(w)}))
+	return werr
+}
+
+// isTerminal returns whether w is a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// jsonError is the JSON representation of a ParseError
+type jsonError struct {
+	Message    string     `json:"message"`
+	Code       string     `json:"code"`
+	Suggestion string     `json:"suggestion,omitempty"`
+	Severity   string     `json:"severity"`
+	Filename   string     `json:"filename,omitempty"`
+	Document   int        `json:"document,omitempty"`
+	Line       int        `json:"line"`
+	Column     int        `json:"column"`
+	EndLine    int        `json:"endLine"`
+	EndColumn  int        `json:"endColumn"`
+	Offset     int        `json:"offset"`
+	Related    []Location `json:"related,omitempty"`
+}
+
+// MarshalJSON encodes the error as a JSON object with its message and location
+func (p *ParseError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonError{
+		Message:    p.msg,
+		Code:       string(p.code),
+		Suggestion: p.suggestion,
+		Severity:   "error",
+		Filename:   p.filename,
+		Document:   p.document,
+		Line:       p.Line(),
+		Column:     p.Column(),
+		EndLine:    p.EndLine(),
+		EndColumn:  p.EndColumn(),
+		Offset:     p.Offset(),
+		Related:    p.related,
+	})
+}
+
+// sarifLog is the top level of a SARIF log
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRun is a single run of a tool in a SARIF log
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+// sarifTool describes the tool that produced a SARIF log
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+// sarifDriver names the tool that produced a SARIF log
+type sarifDriver struct {
+	Name           string `json:"name"`
+	InformationURI string `json:"informationUri"`
+}
+
+// sarifResult is a single error in a SARIF log
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+// sarifMessage is the message of a SARIF result
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+// sarifLocation is the location of a SARIF result
+type sarifLocation struct {
+	ID               int                   `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+// sarifPhysicalLocation is a file and region within it
+type sarifPhysicalLocation struct {
+	ArtifactLocation *sarifArtifactLocation `json:"artifactLocation,omitempty"`
+	Region           sarifRegion            `json:"region"`
+}
+
+// sarifArtifactLocation is the file of a SARIF location
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifRegion is the region of a file in a SARIF location
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// WriteSARIF writes errs to w as a SARIF 2.1.0 log, which CI systems can use
+// to annotate the files the errors occurred in
+func WriteSARIF(w io.Writer, errs []*ParseError) error {
+	results := []sarifResult{}
+	for _, err := range errs {
+		result := sarifResult{
+			RuleID:  string(err.code),
+			Level:   "error",
+			Message: sarifMessage{Text: err.msg},
+			Locations: []sarifLocation{{
+				PhysicalLocation: err.sarifLocation(
+					err.Line(),
+					err.Column(),
+					err.EndLine(),
+					err.EndColumn(),
+				),
+			}},
+		}
+
+		for i, loc := range err.related {
+			end := spanEnd(err.src, loc.Offset-err.base, 0)
+			result.RelatedLocations = append(result.RelatedLocations, sarifLocation{
+				ID:               i + 1,
+				PhysicalLocation: err.sarifLocation(loc.Line, loc.Column, err.lineOf(end), err.columnOf(end)),
+				Message:          &sarifMessage{Text: loc.Message},
+			})
+		}
+
+		results = append(results, result)
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "confl",
+				InformationURI: "https://github.com/nalanj/confl",
+			}},
+
+			// columns count characters, where SARIF defaults to UTF-16 units
+			ColumnKind: "unicodeCodePoints",
+			Results:    results,
+		}},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// sarifLocation returns a SARIF location in the error's file
+func (p *ParseError) sarifLocation(line, column, endLine, endColumn int) sarifPhysicalLocation {
+	location := sarifPhysicalLocation{
+		Region: sarifRegion{
+			StartLine:   line,
+			StartColumn: column,
+			EndLine:     endLine,
+			EndColumn:   endColumn,
+		},
+	}
+	if p.filename != "" {
+		location.ArtifactLocation = &sarifArtifactLocation{URI: p.filename}
+	}
+
+	return location
+}
@@ -0,0 +1,150 @@
+package confl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatCodeColor(t *testing.T) {
+	_, err := Parse(strings.NewReader("a=]"))
+	assert.Equal(
+		t,
+		"\x1b[1;31merror\x1b[0m\x1b[1m: Illegal closing token: got ], expected EOF\x1b[0m\n"+
+			" \x1b[34m-->\x1b[0m 1:3\n"+
+			"\x1b[34m1 |\x1b[0m a=\x1b[1;31m]\x1b[0m\n"+
+			"\x1b[34m  |\x1b[0m   \x1b[1;31m^\x1b[0m\n"+
+			"  \x1b[34m=\x1b[0m \x1b[1mhelp:\x1b[0m remove the extra `]`\n",
+		err.(*ParseError).FormatCode(CodeOptions{Color: true}),
+	)
+}
+
+func TestWriteError(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Parse(strings.NewReader("a=]"))
+	assert.Nil(t, WriteError(&buf, err))
+	assert.Equal(t, err.(*ParseError).FormatCode(CodeOptions{}), buf.String())
+
+	buf.Reset()
+	assert.Nil(t, WriteError(&buf, errors.New("Oops")))
+	assert.Equal(t, "error: Oops\n", buf.String())
+}
+
+func TestParseErrorMarshalJSON(t *testing.T) {
+	_, err := ParseWithOptions(strings.NewReader("a=1\nb='one\ntwo"), Options{Filename: "test.confl"})
+	out, jsonErr := json.Marshal(err)
+	assert.Nil(t, jsonErr)
+	assert.JSONEq(
+		t,
+		`{
+			"message": "Illegal token",
+			"code": "illegal_token",
+			"severity": "error",
+			"filename": "test.confl",
+			"line": 2,
+			"column": 3,
+			"endLine": 3,
+			"endColumn": 4,
+			"offset": 6
+		}`,
+		string(out),
+	)
+}
+
+func TestWriteSARIF(t *testing.T) {
+	_, err := ParseWithOptions(strings.NewReader("a=]"), Options{Filename: "test.confl"})
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteSARIF(&buf, []*ParseError{err.(*ParseError)}))
+	assert.JSONEq(
+		t,
+		`{
+			"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+			"version": "2.1.0",
+			"runs": [{
+				"tool": {"driver": {"name": "confl", "informationUri": "https://github.com/nalanj/confl"}},
+				"columnKind": "unicodeCodePoints",
+				"results": [{
+					"ruleId": "unexpected_close",
+					"level": "error",
+					"message": {"text": "Illegal closing token: got ], expected EOF"},
+					"locations": [{
+						"physicalLocation": {
+							"artifactLocation": {"uri": "test.confl"},
+							"region": {"startLine": 1, "startColumn": 3, "endLine": 1, "endColumn": 4}
+						}
+					}]
+				}]
+			}]
+		}`,
+		buf.String(),
+	)
+}
+
+func TestWriteSARIFColumns(t *testing.T) {
+	// the emoji is one code point but two UTF-16 code units
+	_, err := Parse(strings.NewReader(`a="😀"]`))
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteSARIF(&buf, []*ParseError{err.(*ParseError)}))
+
+	var log struct {
+		Runs []struct {
+			ColumnKind string
+			Results    []struct {
+				Locations []struct {
+					PhysicalLocation struct {
+						Region struct {
+							StartColumn int
+							EndColumn   int
+						}
+					}
+				}
+			}
+		}
+	}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &log))
+
+	run := log.Runs[0]
+	assert.Equal(t, "unicodeCodePoints", run.ColumnKind)
+	assert.Equal(t, 6, run.Results[0].Locations[0].PhysicalLocation.Region.StartColumn)
+	assert.Equal(t, 7, run.Results[0].Locations[0].PhysicalLocation.Region.EndColumn)
+}
+
+func TestWriteSARIFRelated(t *testing.T) {
+	_, err := Parse(strings.NewReader("a=[1 2"))
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteSARIF(&buf, []*ParseError{err.(*ParseError)}))
+
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				RelatedLocations []struct {
+					ID               int
+					PhysicalLocation struct {
+						Region map[string]int
+					}
+					Message struct {
+						Text string
+					}
+				}
+			}
+		}
+	}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &log))
+
+	related := log.Runs[0].Results[0].RelatedLocations
+	assert.Equal(t, 1, len(related))
+	assert.Equal(t, 1, related[0].ID)
+	assert.Equal(t, "`[` opened here", related[0].Message.Text)
+	assert.Equal(
+		t,
+		map[string]int{"startLine": 1, "startColumn": 3, "endLine": 1, "endColumn": 4},
+		related[0].PhysicalLocation.Region,
+	)
+}
@@ -0,0 +1,68 @@
+package confl
+
+// ErrorCode is a stable code identifying the kind of a ParseError. A
+// ParseError unwraps to its code, so it can be checked with errors.Is:
+//
+//	if errors.Is(err, confl.ErrDuplicateKey) {
+//		...
+//	}
+type ErrorCode string
+
+// Error returns the code
+func (c ErrorCode) Error() string {
+	return string(c)
+}
+
+const (
+	// ErrIllegalToken is a token that isn't valid where it appears
+	ErrIllegalToken ErrorCode = "illegal_token"
+
+	// ErrUnexpectedClose is a closing `}`, `]`, or `)` that doesn't match the
+	// map, list, or decorator it's in
+	ErrUnexpectedClose ErrorCode = "unexpected_close"
+
+	// ErrUnclosed is a map, list, or decorator that's still open at the end
+	// of the document
+	ErrUnclosed ErrorCode = "unclosed"
+
+	// ErrUnclosedDecorator is a decorator holding something other than a
+	// single value
+	ErrUnclosedDecorator ErrorCode = "unclosed_decorator"
+
+	// ErrMissingDelimiter is a map key that isn't followed by `=`
+	ErrMissingDelimiter ErrorCode = "missing_delimiter"
+
+	// ErrMissingValue is a map key or decorator without a value
+	ErrMissingValue ErrorCode = "missing_value"
+
+	// ErrDuplicateKey is a key that appears more than once in a map
+	ErrDuplicateKey ErrorCode = "duplicate_key"
+
+	// ErrNullKey is a null used as a map key
+	ErrNullKey ErrorCode = "null_key"
+
+	// ErrNumberKey is a number, size, or duration used as a map key
+	ErrNumberKey ErrorCode = "number_key"
+
+	// ErrDateTimeKey is a date or time used as a map key
+	ErrDateTimeKey ErrorCode = "datetime_key"
+
+	// ErrMapKey is a map used as a map key
+	ErrMapKey ErrorCode = "map_key"
+
+	// ErrListKey is a list used as a map key
+	ErrListKey ErrorCode = "list_key"
+
+	// ErrTooDeep is nesting deeper than Options.MaxDepth allows
+	ErrTooDeep ErrorCode = "too_deep"
+
+	// ErrTooLarge is a document larger than Options.MaxSize allows
+	ErrTooLarge ErrorCode = "too_large"
+
+	// ErrDecoratorNotAllowed is a decorator missing from Options.Decorators
+	ErrDecoratorNotAllowed ErrorCode = "decorator_not_allowed"
+
+	// ErrInvalidNumber is a number that isn't in canonical form when parsing
+	// with Options.StrictNumbers
+	ErrInvalidNumber ErrorCode = "invalid_number"
+)
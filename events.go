@@ -0,0 +1,161 @@
+package confl
+
+import (
+	"fmt"
+	"io"
+)
+
+// EventType is the type of an Event
+type EventType int
+
+const (
+	// EventMapStart starts a map, which is followed by a key and a value
+	// for each pair in the map, then EventEnd
+	EventMapStart EventType = iota
+
+	// EventListStart starts a list, which is followed by each item in the
+	// list, then EventEnd
+	EventListStart
+
+	// EventEnd ends the innermost map or list
+	EventEnd
+
+	// EventKey is a map key
+	EventKey
+
+	// EventValue is a value that's not a map or list
+	EventValue
+)
+
+// String returns the name of the event type
+func (t EventType) String() string {
+	switch t {
+	case EventMapStart:
+		return "map start"
+	case EventListStart:
+		return "list start"
+	case EventEnd:
+		return "end"
+	case EventKey:
+		return "key"
+	case EventValue:
+		return "value"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a single part of a document parsed by ParseEvents
+type Event struct {
+
+	// Type is the type of event
+	Type EventType
+
+	// NodeType is the type of the node the event is for. For EventEnd it's
+	// the type of the map or list being ended.
+	NodeType NodeType
+
+	// Value is the value of a key or value
+	Value string
+
+	// Decorator is the decorator of the node the event is for, if any
+	Decorator string
+
+	// Offset is the byte offset in the document of the token the event is
+	// for
+	Offset int
+}
+
+// ParseEvents parses a document from a reader without building its tree,
+// calling fn with an event for each part of the document as it's parsed. The
+// document is read as it's parsed, so memory use is bounded by the length of
+// the longest line and the depth of nesting rather than the document's size.
+//
+// With DuplicateError, the default, the keys of each open map are kept to
+// find duplicates, so memory also grows with the number of keys in a map.
+// With DuplicateLastWins or DuplicateMerge no keys are kept, and a duplicate
+// key is reported as events for each definition, since earlier events can't
+// be taken back.
+//
+// Parsing stops at the first error, including an error returned by fn, and
+// returns it.
+func ParseEvents(r io.Reader, opts Options, fn func(Event) error) error {
+	if opts.MaxSize > 0 {
+		r = io.LimitReader(r, int64(opts.MaxSize)+1)
+	}
+
+	scan := newReaderScanner(r)
+	scan.opts = opts
+	scan.events = fn
+
+	err := parseEvents(scan)
+
+	if scan.readErr != nil {
+		return scan.readErr
+	}
+	if opts.MaxSize > 0 && scan.base+len(scan.src) > opts.MaxSize {
+		return newParseError(
+			ErrTooLarge,
+			fmt.Sprintf("Document is larger than the maximum of %d bytes", opts.MaxSize),
+			scan,
+			opts.MaxSize,
+			0,
+		)
+	}
+
+	return err
+}
+
+// parseEvents parses the root of a document, emitting its events
+func parseEvents(scan *scanner) error {
+	if scan.opts.AnyRoot && !isImplicitMap(scan) {
+		_, err := parseRootValue(scan)
+		return err
+	}
+
+	if err := scan.emitStart(EventMapStart, "", 0); err != nil {
+		return err
+	}
+
+	root, err := parseMap(scan, eofToken, "")
+	if err != nil {
+		return err
+	}
+
+	return scan.emit(EventEnd, root, scan.valueOffset)
+}
+
+// emit sends the event for a node to the event handler when parsing events
+func (s *scanner) emit(eventType EventType, n Node, offset int) error {
+	if s.events == nil {
+		return nil
+	}
+
+	return s.events(Event{
+		Type:      eventType,
+		NodeType:  n.Type(),
+		Value:     n.Value(),
+		Decorator: n.Decorator(),
+		Offset:    offset,
+	})
+}
+
+// emitStart sends the event starting a map or list to the event handler when
+// parsing events
+func (s *scanner) emitStart(eventType EventType, decorator string, offset int) error {
+	if s.events == nil {
+		return nil
+	}
+
+	nodeType := MapType
+	if eventType == EventListStart {
+		nodeType = ListType
+	}
+
+	return s.events(Event{
+		Type:      eventType,
+		NodeType:  nodeType,
+		Decorator: decorator,
+		Offset:    offset,
+	})
+}
@@ -0,0 +1,203 @@
+package confl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// generatedDoc returns a document with n hosts, one per line
+func generatedDoc(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "host%d={addr=\"10.0.%d.%d\" tags=[web linux]}\n", i, i/256, i%256)
+	}
+
+	return b.String()
+}
+
+func TestParseEvents(t *testing.T) {
+	src := `a=dec({b=1}) c=[x null()] "d"=2019-05-01`
+
+	events := []Event{}
+	err := ParseEvents(strings.NewReader(src), Options{}, func(e Event) error {
+		events = append(events, e)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		[]Event{
+			{Type: EventMapStart, NodeType: MapType, Offset: 0},
+			{Type: EventKey, NodeType: WordType, Value: "a", Offset: 0},
+			{Type: EventMapStart, NodeType: MapType, Decorator: "dec", Offset: 6},
+			{Type: EventKey, NodeType: WordType, Value: "b", Offset: 7},
+			{Type: EventValue, NodeType: NumberType, Value: "1", Offset: 9},
+			{Type: EventEnd, NodeType: MapType, Decorator: "dec", Offset: 10},
+			{Type: EventKey, NodeType: WordType, Value: "c", Offset: 13},
+			{Type: EventListStart, NodeType: ListType, Offset: 15},
+			{Type: EventValue, NodeType: WordType, Value: "x", Offset: 16},
+			{Type: EventValue, NodeType: NullType, Offset: 18},
+			{Type: EventEnd, NodeType: ListType, Offset: 24},
+			{Type: EventKey, NodeType: StringType, Value: "d", Offset: 26},
+			{Type: EventValue, NodeType: DateType, Value: "2019-05-01", Offset: 30},
+			{Type: EventEnd, NodeType: MapType, Offset: 40},
+		},
+		events,
+	)
+}
+
+func TestParseEventsAnyRoot(t *testing.T) {
+	types := []EventType{}
+	err := ParseEvents(strings.NewReader("[a b]"), Options{AnyRoot: true}, func(e Event) error {
+		types = append(types, e.Type)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []EventType{EventListStart, EventValue, EventValue, EventEnd}, types)
+}
+
+func TestParseEventsLargeDocument(t *testing.T) {
+	src := generatedDoc(5000)
+
+	hosts := 0
+	err := ParseEvents(iotest.HalfReader(strings.NewReader(src)), Options{}, func(e Event) error {
+		if e.Type == EventKey && strings.HasPrefix(e.Value, "host") {
+			assert.Equal(t, e.Value, src[e.Offset:e.Offset+len(e.Value)])
+			hosts++
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 5000, hosts)
+}
+
+func TestParseEventsErrors(t *testing.T) {
+	src := generatedDoc(5000) + "broken=]\n"
+
+	err := ParseEvents(strings.NewReader(src), Options{Filename: "hosts.confl"}, func(e Event) error {
+		return nil
+	})
+	parseErr := err.(*ParseError)
+	assert.Equal(t, 5001, parseErr.Line())
+	assert.Equal(t, 8, parseErr.Column())
+	assert.Equal(t, len(src)-2, parseErr.Offset())
+	assert.Equal(
+		t,
+		"error: Illegal closing token: got ], expected EOF\n"+
+			"    --> hosts.confl:5001:8\n"+
+			"5001 | broken=]\n"+
+			"     |        ^\n"+
+			"     = help: remove the extra `]`\n",
+		parseErr.FormatCode(CodeOptions{}),
+	)
+
+	// the opener of an unclosed map may no longer be in memory
+	err = ParseEvents(strings.NewReader("big={\n"+generatedDoc(5000)), Options{}, func(e Event) error {
+		return nil
+	})
+	parseErr = err.(*ParseError)
+	assert.Equal(t, ErrUnclosed, parseErr.Code())
+	assert.Equal(t, 0, len(parseErr.Related()))
+	assert.Equal(t, "add a closing `}`", parseErr.Suggestion())
+}
+
+func TestParseEventsStop(t *testing.T) {
+	stop := errors.New("stop")
+
+	keys := 0
+	err := ParseEvents(strings.NewReader(generatedDoc(10)), Options{}, func(e Event) error {
+		if e.Type == EventKey {
+			keys++
+		}
+		if keys == 3 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 3, keys)
+}
+
+func TestParseEventsMaxSize(t *testing.T) {
+	err := ParseEvents(strings.NewReader(generatedDoc(100)), Options{MaxSize: 1000}, func(e Event) error {
+		return nil
+	})
+	assert.Equal(t, ErrTooLarge, err.(*ParseError).Code())
+}
+
+func TestReaderScannerWindow(t *testing.T) {
+	src := generatedDoc(20000)
+	scan := newReaderScanner(strings.NewReader(src))
+
+	for token := scan.Token(); token.Type != eofToken; token = scan.Token() {
+		assert.NotEqual(t, illegalToken, token.Type)
+		if token.Type == wordToken {
+			assert.Equal(t, token.Content, src[token.Offset:token.Offset+len(token.Content)])
+		}
+	}
+
+	// the window stays far smaller than the document
+	assert.True(t, cap(scan.src) < len(src)/4)
+}
+
+// keysReader generates a document with n keys in its root map without
+// holding the document in memory
+type keysReader struct {
+	n, i int
+	buf  []byte
+}
+
+func (r *keysReader) Read(p []byte) (int, error) {
+	for len(r.buf) < len(p) && r.i < r.n {
+		r.buf = append(r.buf, fmt.Sprintf("key%d=%d\n", r.i, r.i)...)
+		r.i++
+	}
+	if len(r.buf) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[:copy(r.buf, r.buf[n:])]
+	return n, nil
+}
+
+func TestParseEventsManyKeys(t *testing.T) {
+	const keys = 300000
+
+	// heapAt returns the live heap after a collection
+	heapAt := func() uint64 {
+		var stats runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		return stats.HeapAlloc
+	}
+
+	var start, end uint64
+	count := 0
+	err := ParseEvents(&keysReader{n: keys}, Options{Duplicates: DuplicateLastWins}, func(e Event) error {
+		if e.Type != EventKey {
+			return nil
+		}
+
+		count++
+		switch count {
+		case 50000:
+			start = heapAt()
+		case keys:
+			end = heapAt()
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, keys, count)
+
+	// the heap doesn't grow with the keys that have been read
+	assert.True(t, end < start+1<<20, "heap grew from %d to %d bytes", start, end)
+}
@@ -0,0 +1,154 @@
+package confl
+
+import (
+	"reflect"
+	"strings"
+)
+
+// field is a struct field that map keys decode into
+type field struct {
+
+	// name is the key the field is decoded from
+	name string
+
+	// index is the index sequence of the field for reflect.Value.FieldByIndex
+	index []int
+
+	// required notes that it's an error for the key to be missing
+	required bool
+
+	// hasDefault notes that the field has a default value
+	hasDefault bool
+
+	// defaultValue is the default value in confl syntax, decoded into the
+	// field when the key is missing
+	defaultValue string
+
+	// remain notes that the field is a map that gets the keys without a field
+	remain bool
+
+	// decorator notes that the field gets the decorator of the map
+	decorator bool
+
+	// group notes that the field is a map that gets the keys decorated with
+	// the name, keyed by their values
+	group bool
+}
+
+// structFields returns the fields of a struct type that keys decode into,
+// including the fields of inline structs
+func structFields(t reflect.Type) []field {
+	fields := []field{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		tag := sf.Tag.Get("confl")
+		if tag == "-" {
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		f := field{name: opts[0], index: sf.Index}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+
+		inline := false
+		for _, opt := range opts[1:] {
+			switch {
+			case opt == "required":
+				f.required = true
+			case opt == "inline":
+				inline = true
+			case opt == "remain":
+				f.remain = true
+			case opt == "decorator":
+				f.decorator = true
+			case opt == "group":
+				f.group = true
+			case strings.HasPrefix(opt, "default="):
+				f.hasDefault = true
+				f.defaultValue = strings.TrimPrefix(opt, "default=")
+			}
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if inline && ft.Kind() == reflect.Struct {
+			for _, inner := range structFields(ft) {
+				inner.index = append(append([]int{}, sf.Index...), inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+// fieldNamed returns the index of the field for a key, matching the name
+// exactly if possible and otherwise regardless of case, or -1 if there isn't
+// one
+func fieldNamed(fields []field, key string) int {
+	folded := -1
+	for i, f := range fields {
+		if f.remain || f.decorator || f.group {
+			continue
+		}
+		if f.name == key {
+			return i
+		}
+		if folded < 0 && strings.EqualFold(f.name, key) {
+			folded = i
+		}
+	}
+
+	return folded
+}
+
+// remainField returns the index of the field that gets the keys without a
+// field, or -1 if there isn't one
+func remainField(fields []field) int {
+	for i, f := range fields {
+		if f.remain {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// groupField returns the index of the field that gets the keys with a
+// decorator, or -1 if there isn't one
+func groupField(fields []field, decorator string) int {
+	for i, f := range fields {
+		if f.group && f.name == decorator {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// fieldByIndex returns the field of v at index like reflect.Value.FieldByIndex,
+// allocating any nil pointers to inline structs along the way
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
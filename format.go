@@ -0,0 +1,198 @@
+package confl
+
+import (
+	"bytes"
+	"strings"
+)
+
+// formatIndent is the indentation used for each level of nesting
+const formatIndent = "  "
+
+// Format formats a document in the canonical confl style. Comments are kept,
+// each key in the document or in a map spanning several lines is placed on its
+// own line, nested lines are indented by two spaces, runs of blank lines are
+// collapsed to one, and spacing within a line is normalized.
+func Format(src []byte) ([]byte, error) {
+	cst, err := parseCST(src)
+	if err != nil {
+		return nil, err
+	}
+
+	// find the tokens that have to start a line, which are keys of the
+	// document and of multi-line maps along with the end of those maps
+	lineStarts := make(map[int]bool)
+	var walk func(n Node, root bool)
+	walk = func(n Node, root bool) {
+		span := cst.spans[n]
+		multiline := root || (n.Type() == MapType &&
+			bytes.Contains(src[cst.tokens[span.start].Offset:cst.tokens[span.end].Offset], []byte("\n")))
+
+		for i, child := range n.Children() {
+			if multiline && i%2 == 0 {
+				lineStarts[cst.spans[child].start] = true
+			}
+			walk(child, false)
+		}
+
+		if multiline && !root {
+			// the closing brace comes before the end of any decorator
+			end := span.end
+			for cst.tokens[end].Text != "}" {
+				end--
+			}
+			lineStarts[end] = true
+		}
+	}
+	walk(cst.root, true)
+
+	var buf bytes.Buffer
+	depth := 0
+	newlines := 0
+	var prev *CSTToken
+
+	for i := range cst.tokens {
+		tok := &cst.tokens[i]
+
+		if tok.Kind == CSTWhitespace {
+			newlines += strings.Count(tok.Text, "\n")
+			continue
+		}
+
+		closing := tok.Kind == CSTSyntax && (tok.Text == "}" || tok.Text == "]")
+		if closing {
+			depth--
+		}
+
+		switch {
+		case prev == nil:
+		case newlines > 0 || prev.Kind == CSTComment || lineStarts[i]:
+			if newlines > 1 {
+				buf.WriteString("\n")
+			}
+			buf.WriteString("\n")
+			buf.WriteString(strings.Repeat(formatIndent, depth))
+		case formatSpaced(prev, tok):
+			buf.WriteString(" ")
+		}
+
+		buf.WriteString(strings.TrimRight(tok.Text, " \t\r"))
+
+		if tok.Kind == CSTSyntax && (tok.Text == "{" || tok.Text == "[") {
+			depth++
+		}
+
+		prev = tok
+		newlines = 0
+	}
+
+	if buf.Len() > 0 {
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// formatSpaced returns true if a space belongs between two tokens on the same
+// line
+func formatSpaced(prev, next *CSTToken) bool {
+	if next.Kind == CSTComment {
+		return true
+	}
+
+	switch prev.Text {
+	case "=", "{", "[":
+		return false
+	}
+	if strings.HasSuffix(prev.Text, "(") {
+		return false
+	}
+
+	switch next.Text {
+	case "=", "}", "]", ")":
+		return false
+	}
+
+	return true
+}
+
+// formatNode returns n written in confl syntax on a single line
+func formatNode(n Node) string {
+	var b strings.Builder
+	writeNode(&b, n)
+	return b.String()
+}
+
+// formatDocument returns a map written as a document, with each key on its
+// own line
+func formatDocument(n Node) string {
+	var b strings.Builder
+	for _, pair := range KVPairs(n) {
+		writeNode(&b, pair.Key)
+		b.WriteString("=")
+		writeNode(&b, pair.Value)
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// writeNode writes n in confl syntax on a single line to b
+func writeNode(b *strings.Builder, n Node) {
+	if n.Type() == NullType {
+		b.WriteString("null()")
+		return
+	}
+
+	if n.Decorator() != "" {
+		b.WriteString(n.Decorator())
+		b.WriteString("(")
+		defer b.WriteString(")")
+	}
+
+	switch n.Type() {
+	case MapType:
+		b.WriteString("{")
+		for i, pair := range KVPairs(n) {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			writeNode(b, pair.Key)
+			b.WriteString("=")
+			writeNode(b, pair.Value)
+		}
+		b.WriteString("}")
+	case ListType:
+		b.WriteString("[")
+		for i, child := range n.Children() {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			writeNode(b, child)
+		}
+		b.WriteString("]")
+	case WordType:
+		if isWord(n.Value()) {
+			b.WriteString(n.Value())
+		} else {
+			writeString(b, n.Value())
+		}
+	case StringType:
+		writeString(b, n.Value())
+	default:
+		b.WriteString(n.Value())
+	}
+}
+
+// writeString writes s to b as a quoted string
+func writeString(b *strings.Builder, s string) {
+	b.WriteString(`"`)
+	b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s))
+	b.WriteString(`"`)
+}
+
+// isWord returns whether s can be written as a word rather than a string
+func isWord(s string) bool {
+	scan := newScanner([]byte(s))
+	tok := scan.Token()
+	return tok.Type == wordToken && tok.Content == s && scan.Token().Type == eofToken
+}
@@ -0,0 +1,59 @@
+package confl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		out  string
+		err  bool
+	}{
+		{"empty document", "", "", false},
+		{"keys on their own lines", `test = 23 "also"=this`, "test=23\n\"also\"=this\n", false},
+		{
+			"inline map stays inline",
+			`vpn = {  host="12.12.12.12"   user=frank }`,
+			"vpn={host=\"12.12.12.12\" user=frank}\n",
+			false,
+		},
+		{
+			"multi-line map is indented",
+			"device(wifi0)={ network=\"wifi\"\n\tdhcp=true   # use dhcp\n\n\n\n dns=[ \"10.0.0.1\" \"10.0.0.2\" ] }",
+			"device(wifi0)={\n  network=\"wifi\"\n  dhcp=true # use dhcp\n\n  dns=[\"10.0.0.1\" \"10.0.0.2\"]\n}\n",
+			false,
+		},
+		{
+			"decorated multi-line map",
+			"key=dec({a=1\nb=2})",
+			"key=dec({\n  a=1\n  b=2\n})\n",
+			false,
+		},
+		{
+			"comments are kept",
+			"# top comment\n\n   key=path( \"/etc/vpn.key\" )   \n# end",
+			"# top comment\n\nkey=path(\"/etc/vpn.key\")\n# end\n",
+			false,
+		},
+		{"parse errors", "key=", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := Format([]byte(test.src))
+			assert.Equal(t, test.err, err != nil)
+			if test.err {
+				return
+			}
+			assert.Equal(t, test.out, string(out))
+
+			again, err := Format(out)
+			assert.Nil(t, err)
+			assert.Equal(t, test.out, string(again))
+		})
+	}
+}
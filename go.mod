@@ -1,5 +1,5 @@
 module github.com/nalanj/confl
 
-go 1.12
+go 1.13
 
 require github.com/stretchr/testify v1.3.0
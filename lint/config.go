@@ -0,0 +1,118 @@
+package lint
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/nalanj/confl"
+)
+
+// Config configures which rules run and their limits
+type Config struct {
+
+	// Disabled is the set of rule names that won't be run
+	Disabled map[string]bool
+
+	// MaxDepth is the deepest maps may be nested, where maps in the document
+	// have a depth of 1. Zero means there's no limit.
+	MaxDepth int
+
+	// MaxLineLength is the longest a line may be, in characters. Zero means
+	// there's no limit.
+	MaxLineLength int
+
+	// Decorators is the allowlist of decorators. When it's empty any decorator
+	// is allowed.
+	Decorators []string
+}
+
+// DefaultConfig returns the configuration used when there's no .confllint
+// file
+func DefaultConfig() *Config {
+	return &Config{
+		Disabled:      make(map[string]bool),
+		MaxDepth:      5,
+		MaxLineLength: 120,
+	}
+}
+
+// LoadConfig reads a configuration from a .confllint file, which is itself a
+// confl document:
+//
+//	disable=[quote_style]
+//	max_depth=4
+//	max_line_length=100
+//	decorators=[path device]
+//
+// Any setting that's left out keeps its default.
+func LoadConfig(r io.Reader) (*Config, error) {
+	doc, err := confl.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := DefaultConfig()
+	for _, pair := range confl.KVPairs(doc) {
+		switch pair.Key.Value() {
+		case "disable":
+			names, err := textList(pair)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range names {
+				if !isRule(name) {
+					return nil, fmt.Errorf("Unknown rule %s", name)
+				}
+				cfg.Disabled[name] = true
+			}
+		case "max_depth":
+			if cfg.MaxDepth, err = number(pair); err != nil {
+				return nil, err
+			}
+		case "max_line_length":
+			if cfg.MaxLineLength, err = number(pair); err != nil {
+				return nil, err
+			}
+		case "decorators":
+			if cfg.Decorators, err = textList(pair); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Unknown setting %s", pair.Key.Value())
+		}
+	}
+
+	return cfg, nil
+}
+
+// textList returns the values of a setting that's a list of words or strings
+func textList(pair confl.KVPair) ([]string, error) {
+	if pair.Value.Type() != confl.ListType {
+		return nil, fmt.Errorf("Setting %s must be a list", pair.Key.Value())
+	}
+
+	values := []string{}
+	for _, child := range pair.Value.Children() {
+		if !confl.IsText(child) {
+			return nil, fmt.Errorf("Setting %s must be a list of words", pair.Key.Value())
+		}
+		values = append(values, child.Value())
+	}
+
+	return values, nil
+}
+
+// number returns the value of a setting that's a positive integer
+func number(pair confl.KVPair) (int, error) {
+	if pair.Value.Type() != confl.NumberType {
+		return 0, fmt.Errorf("Setting %s must be a number", pair.Key.Value())
+	}
+
+	n, err := strconv.Atoi(pair.Value.Value())
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("Setting %s must be a positive integer", pair.Key.Value())
+	}
+
+	return n, nil
+}
@@ -0,0 +1,259 @@
+/*
+Package lint checks confl documents for problems beyond syntax errors, such as
+inconsistent style or overly complex structure.
+
+Each check is a rule with a name that can be disabled through a Config, which
+is usually loaded from a .confllint file.
+*/
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nalanj/confl"
+)
+
+// Issue is a single problem found by a rule
+type Issue struct {
+
+	// Rule is the name of the rule that found the issue
+	Rule string `json:"rule"`
+
+	// Message describes the issue
+	Message string `json:"message"`
+
+	// Line is the line of the issue, starting at 1
+	Line int `json:"line"`
+
+	// Column is the character offset in the line of the issue, starting at 1
+	Column int `json:"column"`
+}
+
+// rule is a named check run against a document
+type rule struct {
+	name  string
+	check func(l *linter)
+}
+
+// rules are all of the rules, in the order they run
+var rules = []rule{
+	{"quote_style", checkQuoteStyle},
+	{"bool_case", checkBoolCase},
+	{"key_case", checkKeyCase},
+	{"decorators", checkDecorators},
+	{"max_depth", checkMaxDepth},
+	{"line_length", checkLineLength},
+}
+
+// isRule returns true if name is the name of a rule
+func isRule(name string) bool {
+	for _, r := range rules {
+		if r.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// linter holds the state for linting a single document
+type linter struct {
+	cfg    *Config
+	src    []byte
+	cst    *confl.CST
+	rule   string
+	issues []Issue
+}
+
+// Lint checks a document against every enabled rule and returns the issues
+// found, ordered by position. If the document can't be parsed the parse error
+// is returned.
+func Lint(src []byte, cfg *Config) ([]Issue, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	cst, err := confl.ParseCST(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{cfg: cfg, src: src, cst: cst, issues: []Issue{}}
+	for _, r := range rules {
+		if !cfg.Disabled[r.name] {
+			l.rule = r.name
+			r.check(l)
+		}
+	}
+
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		a, b := l.issues[i], l.issues[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+
+	return l.issues, nil
+}
+
+// report records an issue for the current rule at a byte offset
+func (l *linter) report(offset int, format string, args ...interface{}) {
+	lineStart := bytes.LastIndexByte(l.src[:offset], '\n') + 1
+
+	l.issues = append(l.issues, Issue{
+		Rule:    l.rule,
+		Message: fmt.Sprintf(format, args...),
+		Line:    bytes.Count(l.src[:offset], []byte("\n")) + 1,
+		Column:  utf8.RuneCount(l.src[lineStart:offset]) + 1,
+	})
+}
+
+// reportNode records an issue for the current rule at a node
+func (l *linter) reportNode(n confl.Node, format string, args ...interface{}) {
+	start, _, _ := l.cst.Span(n)
+	l.report(start, format, args...)
+}
+
+// walk calls fn for every node in the document along with its map depth
+func (l *linter) walk(fn func(n confl.Node, depth int)) {
+	var walk func(n confl.Node, depth int)
+	walk = func(n confl.Node, depth int) {
+		fn(n, depth)
+
+		if n.Type() == confl.MapType {
+			depth++
+		}
+		for _, child := range n.Children() {
+			walk(child, depth)
+		}
+	}
+
+	for _, child := range l.cst.Root().Children() {
+		walk(child, 1)
+	}
+}
+
+// checkQuoteStyle reports strings that use a different quote than the first
+// string in the document
+func checkQuoteStyle(l *linter) {
+	var quote byte
+
+	for _, tok := range l.cst.Tokens() {
+		if tok.Kind != confl.CSTSyntax || (tok.Text[0] != '"' && tok.Text[0] != '\'') {
+			continue
+		}
+
+		if quote == 0 {
+			quote = tok.Text[0]
+		} else if tok.Text[0] != quote {
+			l.report(tok.Offset, "String quoted with %c, expected %c", tok.Text[0], quote)
+		}
+	}
+}
+
+// boolWords are the words that represent booleans
+var boolWords = map[string]bool{"true": true, "false": true, "yes": true, "no": true}
+
+// checkBoolCase reports boolean words with a different case than the first
+// boolean word in the document
+func checkBoolCase(l *linter) {
+	var style string
+
+	l.walk(func(n confl.Node, depth int) {
+		if n.Type() != confl.WordType || !boolWords[strings.ToLower(n.Value())] {
+			return
+		}
+
+		var nodeStyle string
+		switch n.Value() {
+		case strings.ToLower(n.Value()):
+			nodeStyle = "lower case"
+		case strings.ToUpper(n.Value()):
+			nodeStyle = "upper case"
+		default:
+			l.reportNode(n, "Boolean %s is mixed case", n.Value())
+			return
+		}
+
+		if style == "" {
+			style = nodeStyle
+		} else if nodeStyle != style {
+			l.reportNode(n, "Boolean %s is %s, expected %s", n.Value(), nodeStyle, style)
+		}
+	})
+}
+
+// checkKeyCase reports keys in a map that differ from another key only by case
+func checkKeyCase(l *linter) {
+	check := func(n confl.Node) {
+		seen := make(map[string]string)
+		for _, pair := range confl.KVPairs(n) {
+			key := pair.Key.Value()
+			if pair.Key.Decorator() != "" {
+				key = fmt.Sprintf("%s(%s)", pair.Key.Decorator(), key)
+			}
+
+			lower := strings.ToLower(key)
+			if first, ok := seen[lower]; ok {
+				l.reportNode(pair.Key, "Key %s differs from key %s only by case", key, first)
+			} else {
+				seen[lower] = key
+			}
+		}
+	}
+
+	check(l.cst.Root())
+	l.walk(func(n confl.Node, depth int) {
+		if n.Type() == confl.MapType {
+			check(n)
+		}
+	})
+}
+
+// checkDecorators reports decorators that aren't in the allowlist
+func checkDecorators(l *linter) {
+	if len(l.cfg.Decorators) == 0 {
+		return
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range l.cfg.Decorators {
+		allowed[name] = true
+	}
+
+	l.walk(func(n confl.Node, depth int) {
+		if n.Decorator() != "" && !allowed[n.Decorator()] {
+			l.reportNode(n, "Decorator %s is not allowed", n.Decorator())
+		}
+	})
+}
+
+// checkMaxDepth reports maps nested deeper than the maximum depth
+func checkMaxDepth(l *linter) {
+	if l.cfg.MaxDepth == 0 {
+		return
+	}
+
+	l.walk(func(n confl.Node, depth int) {
+		if n.Type() == confl.MapType && depth == l.cfg.MaxDepth+1 {
+			l.reportNode(n, "Map is nested %d deep, more than %d", depth, l.cfg.MaxDepth)
+		}
+	})
+}
+
+// checkLineLength reports lines longer than the maximum line length
+func checkLineLength(l *linter) {
+	if l.cfg.MaxLineLength == 0 {
+		return
+	}
+
+	offset := 0
+	for _, line := range bytes.Split(l.src, []byte("\n")) {
+		if length := utf8.RuneCount(bytes.TrimRight(line, "\r")); length > l.cfg.MaxLineLength {
+			l.report(offset, "Line is %d characters, more than %d", length, l.cfg.MaxLineLength)
+		}
+		offset += len(line) + 1
+	}
+}
@@ -0,0 +1,125 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		cfg    *Config
+		issues []Issue
+	}{
+		{
+			"clean document",
+			"device={\n  dhcp=true\n  dns=[\"10.0.0.1\" \"10.0.0.2\"]\n}\n",
+			nil,
+			[]Issue{},
+		},
+		{
+			"quote style",
+			`a="one" b='two' c="three"`,
+			nil,
+			[]Issue{{"quote_style", "String quoted with ', expected \"", 1, 11}},
+		},
+		{
+			"bool case",
+			"a=true\nb=FALSE\nc=True\nd=yes_please",
+			nil,
+			[]Issue{
+				{"bool_case", "Boolean FALSE is upper case, expected lower case", 2, 3},
+				{"bool_case", "Boolean True is mixed case", 3, 3},
+			},
+		},
+		{
+			"key case",
+			"Host=a\nmap={key=1 KEY=2}\nhost=b",
+			nil,
+			[]Issue{
+				{"key_case", "Key KEY differs from key key only by case", 2, 12},
+				{"key_case", "Key host differs from key Host only by case", 3, 1},
+			},
+		},
+		{
+			"decorated key case",
+			"dev(eth0)=a\nhost(eth0)=b\nDEV(eth0)=c",
+			nil,
+			[]Issue{
+				{"key_case", "Key DEV(eth0) differs from key dev(eth0) only by case", 3, 1},
+			},
+		},
+		{
+			"decorators",
+			"a=path(\"/etc\") b=[size(12)] dev(c)=1",
+			&Config{Decorators: []string{"path"}, MaxDepth: 5, MaxLineLength: 120},
+			[]Issue{
+				{"decorators", "Decorator size is not allowed", 1, 19},
+				{"decorators", "Decorator dev is not allowed", 1, 29},
+			},
+		},
+		{
+			"max depth",
+			"a={b={c={}}}",
+			&Config{MaxDepth: 2, MaxLineLength: 120},
+			[]Issue{{"max_depth", "Map is nested 3 deep, more than 2", 1, 9}},
+		},
+		{
+			"line length",
+			"short=1\nlong=\"" + strings.Repeat("é", 20) + "\"",
+			&Config{MaxDepth: 5, MaxLineLength: 20},
+			[]Issue{{"line_length", "Line is 27 characters, more than 20", 2, 1}},
+		},
+		{
+			"disabled rules",
+			"a=true b=FALSE c='one' d=\"two\"",
+			&Config{Disabled: map[string]bool{"bool_case": true, "quote_style": true}},
+			[]Issue{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issues, err := Lint([]byte(test.src), test.cfg)
+			assert.Nil(t, err)
+			assert.Equal(t, test.issues, issues)
+		})
+	}
+}
+
+func TestLintParseError(t *testing.T) {
+	_, err := Lint([]byte("key="), nil)
+	assert.NotNil(t, err)
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(strings.NewReader(`
+		# lint settings
+		disable=[quote_style]
+		max_depth=4
+		decorators=[path device]
+	`))
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		&Config{
+			Disabled:      map[string]bool{"quote_style": true},
+			MaxDepth:      4,
+			MaxLineLength: 120,
+			Decorators:    []string{"path", "device"},
+		},
+		cfg,
+	)
+
+	_, err = LoadConfig(strings.NewReader(`disable=[not_a_rule]`))
+	assert.NotNil(t, err)
+
+	_, err = LoadConfig(strings.NewReader(`max_depth=deep`))
+	assert.NotNil(t, err)
+
+	_, err = LoadConfig(strings.NewReader(`unknown=1`))
+	assert.NotNil(t, err)
+}
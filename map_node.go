@@ -58,3 +58,55 @@ func KVPairs(n Node) []KVPair {
 
 	return pairs
 }
+
+// KVPairsByDecorator returns the key/value pairs from the map grouped by the
+// decorator on their keys, such as all of the `device(...)` keys in:
+//
+//	device(wifi0)={dhcp=true}
+//	device(eth0)={dhcp=false}
+//
+// Pairs with undecorated keys are grouped under the empty string.
+func KVPairsByDecorator(n Node) map[string][]KVPair {
+	groups := make(map[string][]KVPair)
+	for _, pair := range KVPairs(n) {
+		decorator := pair.Key.Decorator()
+		groups[decorator] = append(groups[decorator], pair)
+	}
+
+	return groups
+}
+
+// mapKey identifies a key within a map. Keys with the same value and
+// different decorators, like `device(wifi0)` and `host(wifi0)`, are different
+// keys.
+type mapKey struct {
+	decorator string
+	value     string
+}
+
+// keyOf returns the identity of a map key node
+func keyOf(n Node) mapKey {
+	return mapKey{decorator: n.Decorator(), value: n.Value()}
+}
+
+// String returns the key as it's written in a document
+func (k mapKey) String() string {
+	if k.decorator == "" {
+		return k.value
+	}
+
+	return k.decorator + "(" + k.value + ")"
+}
+
+// keyIndex returns the index of the value for key in a map node's children,
+// or -1 if the key isn't found
+func keyIndex(n Node, key mapKey) int {
+	children := n.Children()
+	for i := 0; i+1 < len(children); i += 2 {
+		if keyOf(children[i]) == key {
+			return i + 1
+		}
+	}
+
+	return -1
+}
@@ -1,6 +1,7 @@
 package confl
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -31,3 +32,19 @@ func TestMapKVPairs(t *testing.T) {
 		},
 	)
 }
+
+func TestKVPairsByDecorator(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`
+		device(wifi0)={dhcp=true}
+		name=router
+		device(eth0)={dhcp=false}
+	`))
+	assert.Nil(t, err)
+
+	groups := KVPairsByDecorator(doc)
+	assert.Equal(t, 2, len(groups))
+	assert.Equal(t, 2, len(groups["device"]))
+	assert.Equal(t, "wifi0", groups["device"][0].Key.Value())
+	assert.Equal(t, "eth0", groups["device"][1].Key.Value())
+	assert.Equal(t, "router", groups[""][0].Value.Value())
+}
@@ -0,0 +1,324 @@
+package confl
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marshaler is implemented by types that encode themselves as a node
+type Marshaler interface {
+	MarshalConfl() (Node, error)
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	decoratedType     = reflect.TypeOf(Decorated{})
+)
+
+// Marshal returns v written as a confl document, the reverse of Unmarshal. A
+// map or struct is written as a document with each key on its own line, and
+// anything else as a single value, which parses with Options.AnyRoot.
+//
+// Values are encoded by the same rules Unmarshal decodes them with. Structs
+// use the same `confl` tags, where inline fields and the keys of a remain map
+// are written as keys of the struct, the keys of a group map are decorated
+// with its name, and a decorator field decorates the map unless its key has
+// the same decorator. A Decorated is written as a decorated value, and a map
+// key like `device(wifi0)` as a decorated key. A time.Time at midnight UTC is
+// written as a date, like the dates it decodes from, and any other as a date
+// and time. Nil pointers, interfaces, maps, and slices are written as null().
+// Types that implement Marshaler, or otherwise encoding.TextMarshaler, encode
+// themselves, at any depth. Confl has no negative numbers, so they're an
+// error.
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encodeState{}
+	n, err := e.encode(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+
+	if n.Type() == MapType && n.Decorator() == "" {
+		return []byte(formatDocument(n)), nil
+	}
+	return []byte(formatNode(n) + "\n"), nil
+}
+
+// encodeState is the state of encoding Go values into nodes
+type encodeState struct {
+
+	// path is the path of the value being encoded, for errors
+	path []mapKey
+}
+
+// encode returns the node for v
+func (e *encodeState) encode(v reflect.Value) (Node, error) {
+	if !v.IsValid() || isNil(v) {
+		return NewValue(NullType, ""), nil
+	}
+
+	if v.Type().Implements(nodeType) {
+		return v.Interface().(Node), nil
+	}
+
+	if m, ok := marshaler(v, marshalerType).(Marshaler); ok {
+		n, err := m.MarshalConfl()
+		if err != nil {
+			return nil, e.wrap(err)
+		}
+		if n == nil {
+			return NewValue(NullType, ""), nil
+		}
+		return n, nil
+	}
+
+	switch v.Type() {
+	case numberType:
+		return NewValue(NumberType, v.String()), nil
+	case durationType:
+		if v.Int() < 0 {
+			return nil, e.errorf("Cannot marshal negative duration %s", time.Duration(v.Int()))
+		}
+		return NewValue(DurationType, time.Duration(v.Int()).String()), nil
+	case timeType:
+		t := v.Interface().(time.Time)
+
+		// a date decodes to midnight UTC, so it's written back as a date
+		nodeType := DateTimeType
+		if t.Location() == time.UTC && t.Equal(t.Truncate(24*time.Hour)) {
+			nodeType = DateType
+		}
+
+		text, err := FormatTime(t, nodeType)
+		if err != nil {
+			return nil, e.wrap(err)
+		}
+		return NewValue(nodeType, text), nil
+	case decoratedType:
+		n, err := e.encode(v.Field(1))
+		if err != nil {
+			return nil, err
+		}
+		return Decorate(n, v.Field(0).String()), nil
+	}
+
+	if m, ok := marshaler(v, textMarshalerType).(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return nil, e.wrap(err)
+		}
+		return NewValue(StringType, string(text)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		return NewValue(BoolType, strconv.FormatBool(v.Bool())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return nil, e.errorf("Cannot marshal negative number %d", v.Int())
+		}
+		return NewValue(NumberType, strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewValue(NumberType, strconv.FormatUint(v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, e.errorf("Cannot marshal number %v", f)
+		}
+		return NewValue(NumberType, strconv.FormatFloat(f, 'f', -1, v.Type().Bits())), nil
+	case reflect.String:
+		return NewValue(StringType, v.String()), nil
+	case reflect.Slice, reflect.Array:
+		return e.encodeList(v)
+	case reflect.Map:
+		return e.encodeMap(v, "")
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return nil, e.errorf("Cannot marshal %s", v.Type())
+	}
+}
+
+// encodeList returns the list node for a slice or array
+func (e *encodeState) encodeList(v reflect.Value) (Node, error) {
+	items := make([]Node, v.Len())
+	for i := range items {
+		e.path = append(e.path, mapKey{value: strconv.Itoa(i)})
+		item, err := e.encode(v.Index(i))
+		e.path = e.path[:len(e.path)-1]
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+
+	return NewList(items...), nil
+}
+
+// encodeMap returns the map node for a Go map, with its keys in order and
+// decorated with decorator if it isn't empty
+func (e *encodeState) encodeMap(v reflect.Value, decorator string) (Node, error) {
+	keys := make([]string, 0, v.Len())
+	values := make(map[string]reflect.Value, v.Len())
+	for _, k := range v.MapKeys() {
+		var key string
+		if m, ok := k.Interface().(encoding.TextMarshaler); ok {
+			text, err := m.MarshalText()
+			if err != nil {
+				return nil, e.wrap(err)
+			}
+			key = string(text)
+		} else if k.Kind() == reflect.String {
+			key = k.String()
+		} else {
+			return nil, e.errorf("Cannot marshal %s, which doesn't have string keys", v.Type())
+		}
+
+		keys = append(keys, key)
+		values[key] = v.MapIndex(k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]KVPair, 0, len(keys))
+	for _, key := range keys {
+		keyNode := keyNodeFor(key)
+		if decorator != "" {
+			keyNode = newKeyNode(mapKey{decorator: decorator, value: key})
+		}
+
+		pair, err := e.encodePair(keyNode, values[key])
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+
+	return NewMap(pairs...), nil
+}
+
+// encodeStruct returns the map node for a struct
+func (e *encodeState) encodeStruct(v reflect.Value) (Node, error) {
+	pairs := []KVPair{}
+	decorator := ""
+
+	for _, f := range structFields(v.Type()) {
+		fv, ok := fieldValue(v, f.index)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case f.decorator:
+			decorator = fv.String()
+		case f.remain || f.group:
+			if isNil(fv) {
+				continue
+			}
+			keyDecorator := ""
+			if f.group {
+				keyDecorator = f.name
+			}
+			m, err := e.encodeMap(fv, keyDecorator)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, KVPairs(m)...)
+		default:
+			pair, err := e.encodePair(keyNodeFor(f.name), fv)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+
+	// the decorator of the key decodes into the decorator field already
+	if len(e.path) > 0 && e.path[len(e.path)-1].decorator == decorator {
+		decorator = ""
+	}
+
+	return Decorate(NewMap(pairs...), decorator), nil
+}
+
+// encodePair returns the map pair for a key and its value
+func (e *encodeState) encodePair(keyNode Node, v reflect.Value) (KVPair, error) {
+	e.path = append(e.path, keyOf(keyNode))
+	n, err := e.encode(v)
+	e.path = e.path[:len(e.path)-1]
+
+	return KVPair{Key: keyNode, Value: n}, err
+}
+
+// wrap returns err noting the path of the value being encoded, so it can
+// still be unwrapped
+func (e *encodeState) wrap(err error) error {
+	if len(e.path) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("%w at %s", err, joinPatchPath(e.path))
+}
+
+// errorf returns an error noting the path of the value being encoded
+func (e *encodeState) errorf(format string, args ...interface{}) error {
+	return e.wrap(errors.New(fmt.Sprintf(format, args...)))
+}
+
+// keyNodeFor returns the key node for a key as Unmarshal writes it, so a key
+// like `device(wifi0)` is decorated
+func keyNodeFor(key string) Node {
+	i := strings.IndexByte(key, '(')
+	if i > 0 && strings.HasSuffix(key, ")") && isWord(key[:i]) {
+		return newKeyNode(mapKey{decorator: key[:i], value: key[i+1 : len(key)-1]})
+	}
+
+	return newKeyNode(mapKey{value: key})
+}
+
+// marshaler returns v, or a pointer to v if it's addressable, as an
+// interface{} if it implements iface, or nil otherwise
+func marshaler(v reflect.Value, iface reflect.Type) interface{} {
+	if v.Type().Implements(iface) {
+		return v.Interface()
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(iface) {
+		return v.Addr().Interface()
+	}
+
+	return nil
+}
+
+// isNil returns whether v is a nil pointer, interface, map, or slice
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// fieldValue returns the field of v at index, or false if it's inside a nil
+// pointer to an inline struct
+func fieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v, true
+}
@@ -0,0 +1,114 @@
+package confl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name   string
+		v      interface{}
+		result string
+	}{
+		{"nil", nil, "null()\n"},
+		{"string", "Pretty fly", "\"Pretty fly\"\n"},
+		{"bool", true, "true\n"},
+		{"number", 1.5, "1.5\n"},
+		{"list", []interface{}{1, "a b", nil}, "[1 \"a b\" null()]\n"},
+		{
+			"map",
+			map[string]interface{}{"b": []int{1, 2}, "a": map[string]int{"c": 3}},
+			"a={c=3}\nb=[1 2]\n",
+		},
+		{
+			"decorated",
+			map[string]interface{}{"device(wifi0)": Decorated{"path", "/etc/vpn.key"}},
+			"device(wifi0)=path(\"/etc/vpn.key\")\n",
+		},
+		{"durations and times", []interface{}{
+			90 * time.Second,
+			time.Date(2019, 5, 1, 12, 30, 0, 0, time.UTC),
+			time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2019, 5, 1, 0, 0, 0, 0, time.FixedZone("EST", -5*60*60)),
+			Number("123456789012345678901234567890"),
+		}, "[1m30s 2019-05-01T12:30:00Z 2019-05-01 2019-05-01T00:00:00-05:00 123456789012345678901234567890]\n"},
+		{"node", map[string]Node{"a": NewList(NewValue(WordType, "x"))}, "a=[x]\n"},
+		{
+			"marshalers",
+			map[Level]interface{}{2: Endpoint{"tcp", "web:80"}, 1: []Level{2}},
+			"high=tcp(\"web:80\")\nlow=[\"high\"]\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := Marshal(test.v)
+			assert.Nil(t, err)
+			assert.Equal(t, test.result, string(data))
+		})
+	}
+}
+
+func TestMarshalStruct(t *testing.T) {
+	type Common struct {
+		Timeout time.Duration `confl:"timeout"`
+	}
+
+	type Device struct {
+		Kind    string `confl:",decorator"`
+		Network string
+		DNS     []string `confl:"dns"`
+		Proxy   *Device
+		Common  `confl:",inline"`
+		*Extra  `confl:",inline"`
+		Unknown map[string]Node `confl:",remain"`
+		Ignored string          `confl:"-"`
+	}
+
+	dev := Device{
+		Kind:    "wifi",
+		Network: "Pretty fly",
+		DNS:     []string{"10.0.0.1"},
+		Common:  Common{Timeout: 30 * time.Second},
+		Unknown: map[string]Node{"mtu": NewValue(NumberType, "1500")},
+		Ignored: "x",
+	}
+	data, err := Marshal(map[string]Device{"wifi0": dev})
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		"wifi0=wifi({Network=\"Pretty fly\" dns=[\"10.0.0.1\"] Proxy=null() timeout=30s mtu=1500})\n",
+		string(data),
+	)
+
+	// it decodes back to the same struct
+	var decoded map[string]Device
+	assert.Nil(t, Unmarshal(data, &decoded))
+	wifi := decoded["wifi0"]
+	assert.Equal(t, "1500", wifi.Unknown["mtu"].Value())
+	dev.Ignored, dev.Unknown, wifi.Unknown = "", nil, nil
+	assert.Equal(t, dev, wifi)
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		err  string
+	}{
+		{"negative", map[string]int{"a": -1}, "Cannot marshal negative number -1 at /a"},
+		{"negative float", []float64{-1.5}, "Cannot marshal number -1.5 at /0"},
+		{"channel", map[string]interface{}{"a": make(chan int)}, "Cannot marshal chan int at /a"},
+		{"keys", map[int]int{1: 1}, "Cannot marshal map[int]int, which doesn't have string keys"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Marshal(test.v)
+			assert.Equal(t, test.err, err.Error())
+		})
+	}
+}
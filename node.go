@@ -23,3 +23,41 @@ type Node interface {
 func IsText(n Node) bool {
 	return n.Type() == WordType || n.Type() == StringType
 }
+
+// IsNull returns true if the node is null
+func IsNull(n Node) bool {
+	return n.Type() == NullType
+}
+
+// NewValue returns a value node, such as a word or number, with its value as
+// it would be written. nodeType must not be MapType or ListType.
+func NewValue(nodeType NodeType, value string) Node {
+	return &valueNode{nodeType: nodeType, val: value}
+}
+
+// NewMap returns a map node with the given pairs
+func NewMap(pairs ...KVPair) Node {
+	children := make([]Node, 0, 2*len(pairs))
+	for _, pair := range pairs {
+		children = append(children, pair.Key, pair.Value)
+	}
+
+	return &mapNode{children: children}
+}
+
+// NewList returns a list node with the given items
+func NewList(items ...Node) Node {
+	return &listNode{children: append([]Node{}, items...)}
+}
+
+// Decorate returns a copy of n with the given decorator
+func Decorate(n Node, decorator string) Node {
+	switch n.Type() {
+	case MapType:
+		return &mapNode{children: n.Children(), decorator: decorator}
+	case ListType:
+		return &listNode{children: n.Children(), decorator: decorator}
+	default:
+		return &valueNode{nodeType: n.Type(), val: n.Value(), decorator: decorator}
+	}
+}
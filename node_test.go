@@ -23,3 +23,14 @@ func TestNodeIsText(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeTypeString(t *testing.T) {
+	assert.Equal(t, "number", NumberType.String())
+	assert.Equal(t, "map", MapType.String())
+	assert.Equal(t, "unknown", NodeType(-1).String())
+}
+
+func TestNodeIsNull(t *testing.T) {
+	assert.True(t, IsNull(&valueNode{nodeType: NullType}))
+	assert.False(t, IsNull(&valueNode{nodeType: WordType, val: "null"}))
+}
@@ -18,4 +18,59 @@ const (
 
 	// ListType is the NodeType for lists
 	ListType
+
+	// NullType is the NodeType for null, written as null()
+	NullType
+
+	// DateType is the NodeType for dates, such as 2019-05-01
+	DateType
+
+	// TimeType is the NodeType for times of day, such as 10:30:00
+	TimeType
+
+	// DateTimeType is the NodeType for dates and times with an offset, such as
+	// 2019-05-01T10:30:00Z
+	DateTimeType
+
+	// BoolType is the NodeType for booleans, which are only parsed when
+	// Options.Bools is set
+	BoolType
+
+	// SizeType is the NodeType for byte sizes, such as 512MiB
+	SizeType
+
+	// DurationType is the NodeType for durations, such as 2h30m
+	DurationType
 )
+
+// String returns the name of the node type
+func (t NodeType) String() string {
+	switch t {
+	case NumberType:
+		return "number"
+	case WordType:
+		return "word"
+	case StringType:
+		return "string"
+	case MapType:
+		return "map"
+	case ListType:
+		return "list"
+	case NullType:
+		return "null"
+	case DateType:
+		return "date"
+	case TimeType:
+		return "time"
+	case DateTimeType:
+		return "datetime"
+	case BoolType:
+		return "bool"
+	case SizeType:
+		return "size"
+	case DurationType:
+		return "duration"
+	default:
+		return "unknown"
+	}
+}
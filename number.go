@@ -0,0 +1,157 @@
+package confl
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// strictNumberPattern matches numbers in their canonical form, for
+// Options.StrictNumbers
+var strictNumberPattern = regexp.MustCompile(`^((0|[1-9][0-9]*)(\.[0-9]+)?|0[xX][0-9a-fA-F]+)$`)
+
+// Number is the text of a number node. Like json.Number it keeps the number
+// exactly as written, and decodes it on request.
+type Number string
+
+// NodeNumber returns the Number for a number node
+func NodeNumber(n Node) (Number, error) {
+	if n.Type() != NumberType {
+		return "", fmt.Errorf("Node is a %s, not a number", n.Type())
+	}
+
+	return Number(n.Value()), nil
+}
+
+// String returns the number as written
+func (n Number) String() string {
+	return string(n)
+}
+
+// hex returns the digits of a hex number and true, or false if the number
+// isn't hex
+func (n Number) hex() (string, bool) {
+	if strings.HasPrefix(string(n), "0x") || strings.HasPrefix(string(n), "0X") {
+		return string(n[2:]), true
+	}
+
+	return "", false
+}
+
+// Int64 returns the number as an int64
+func (n Number) Int64() (int64, error) {
+	if digits, ok := n.hex(); ok {
+		return strconv.ParseInt(digits, 16, 64)
+	}
+
+	return strconv.ParseInt(string(n), 10, 64)
+}
+
+// Float64 returns the number as a float64
+func (n Number) Float64() (float64, error) {
+	if _, ok := n.hex(); ok {
+		i, err := n.BigInt()
+		if err != nil {
+			return 0, err
+		}
+
+		f, _ := new(big.Float).SetInt(i).Float64()
+		return f, nil
+	}
+
+	return strconv.ParseFloat(string(n), 64)
+}
+
+// BigInt returns the number as a *big.Int
+func (n Number) BigInt() (*big.Int, error) {
+	digits, base := string(n), 10
+	if hex, ok := n.hex(); ok {
+		digits, base = hex, 16
+	}
+
+	i, ok := new(big.Int).SetString(digits, base)
+	if !ok || strings.HasPrefix(digits, "+") || strings.HasPrefix(digits, "-") {
+		return nil, fmt.Errorf("Illegal integer %s", n)
+	}
+
+	return i, nil
+}
+
+// BigFloat returns the number as a *big.Float, with enough precision to hold
+// every digit as written
+func (n Number) BigFloat() (*big.Float, error) {
+	if _, ok := n.hex(); ok {
+		i, err := n.BigInt()
+		if err != nil {
+			return nil, err
+		}
+
+		return new(big.Float).SetInt(i), nil
+	}
+
+	prec := uint(len(n))*4 + 64
+	f, _, err := big.ParseFloat(string(n), 10, prec, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("Illegal number %s", n)
+	}
+
+	return f, nil
+}
+
+// BigRat returns the number as an exact *big.Rat
+func (n Number) BigRat() (*big.Rat, error) {
+	if _, ok := n.hex(); ok {
+		i, err := n.BigInt()
+		if err != nil {
+			return nil, err
+		}
+
+		return new(big.Rat).SetInt(i), nil
+	}
+
+	r, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		return nil, fmt.Errorf("Illegal number %s", n)
+	}
+
+	return r, nil
+}
+
+// DecodeNumber decodes a number node into v, which must be a *Number,
+// *int64, *float64, *big.Int, *big.Float, or *big.Rat
+func DecodeNumber(n Node, v interface{}) error {
+	num, err := NodeNumber(n)
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case *Number:
+		*v = num
+	case *int64:
+		*v, err = num.Int64()
+	case *float64:
+		*v, err = num.Float64()
+	case *big.Int:
+		var i *big.Int
+		if i, err = num.BigInt(); err == nil {
+			v.Set(i)
+		}
+	case *big.Float:
+		var f *big.Float
+		if f, err = num.BigFloat(); err == nil {
+			v.SetPrec(f.Prec()).Set(f)
+		}
+	case *big.Rat:
+		var r *big.Rat
+		if r, err = num.BigRat(); err == nil {
+			v.Set(r)
+		}
+	default:
+		return fmt.Errorf("Cannot decode a number into %T", v)
+	}
+
+	return err
+}
@@ -0,0 +1,87 @@
+package confl
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		name    string
+		num     Number
+		int64   int64
+		intErr  bool
+		float64 float64
+		bigInt  string
+		bigRat  string
+	}{
+		{"integer", "12", 12, false, 12, "12", "12"},
+		{"decimal", "12.5", 0, true, 12.5, "", "25/2"},
+		{"hex", "0x12", 18, false, 18, "18", "18"},
+		{"upper case hex", "0X1f", 31, false, 31, "31", "31"},
+		{
+			"beyond int64",
+			"123456789012345678901234567890",
+			9223372036854775807, true,
+			1.2345678901234568e29,
+			"123456789012345678901234567890",
+			"123456789012345678901234567890",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i, err := test.num.Int64()
+			assert.Equal(t, test.intErr, err != nil)
+			assert.Equal(t, test.int64, i)
+
+			f, err := test.num.Float64()
+			assert.Nil(t, err)
+			assert.Equal(t, test.float64, f)
+
+			bi, err := test.num.BigInt()
+			if test.bigInt == "" {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, test.bigInt, bi.String())
+			}
+
+			br, err := test.num.BigRat()
+			assert.Nil(t, err)
+			assert.Equal(t, test.bigRat, br.RatString())
+		})
+	}
+}
+
+func TestNumberBigFloatPrecision(t *testing.T) {
+	f, err := Number("1.00000000000000000000000000001").BigFloat()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.00000000000000000000000000001", f.Text('f', 29))
+}
+
+func TestDecodeNumber(t *testing.T) {
+	node := &valueNode{nodeType: NumberType, val: "0x10"}
+
+	var num Number
+	assert.Nil(t, DecodeNumber(node, &num))
+	assert.Equal(t, Number("0x10"), num)
+
+	var i int64
+	assert.Nil(t, DecodeNumber(node, &i))
+	assert.Equal(t, int64(16), i)
+
+	bi := new(big.Int)
+	assert.Nil(t, DecodeNumber(node, bi))
+	assert.Equal(t, "16", bi.String())
+
+	bf := new(big.Float)
+	assert.Nil(t, DecodeNumber(&valueNode{nodeType: NumberType, val: "2.5"}, bf))
+	assert.Equal(t, "2.5", bf.String())
+
+	var s string
+	assert.NotNil(t, DecodeNumber(node, &s))
+	assert.NotNil(t, DecodeNumber(&valueNode{nodeType: WordType, val: "12"}, &i))
+}
@@ -0,0 +1,56 @@
+package confl
+
+// Options configures how a document is parsed
+type Options struct {
+
+	// Filename is the name of the file being parsed, which is included in
+	// errors
+	Filename string
+
+	// Bools parses the documented boolean words, true, false, TRUE, FALSE, yes
+	// and no, as BoolType nodes rather than words. Map keys are always left as
+	// words.
+	Bools bool
+
+	// Duplicates is how maps handle a key that appears more than once. By
+	// default it's an error.
+	Duplicates DuplicatePolicy
+
+	// MaxDepth is the maximum number of maps, lists, and decorators that may
+	// be nested inside each other. Zero means no limit.
+	MaxDepth int
+
+	// MaxSize is the maximum size of the document in bytes, or of each
+	// document in a stream read by a Decoder. Zero means no limit.
+	MaxSize int
+
+	// Decorators are the decorators allowed in the document. Nil allows any
+	// decorator. null() is always allowed.
+	Decorators []string
+
+	// StrictNumbers only allows numbers in their canonical form, without
+	// leading zeros, trailing decimal points, or non-ASCII digits
+	StrictNumbers bool
+
+	// AnyRoot allows the document to be a single value of any type, like a
+	// list, instead of requiring an implicit map
+	AnyRoot bool
+}
+
+// DuplicatePolicy is how a map handles a key that appears more than once
+type DuplicatePolicy int
+
+const (
+	// DuplicateError fails parsing with ErrDuplicateKey
+	DuplicateError DuplicatePolicy = iota
+
+	// DuplicateLastWins keeps the last definition of a key, in the place of
+	// the first
+	DuplicateLastWins
+
+	// DuplicateMerge merges the definitions of a key when they're all maps,
+	// and otherwise keeps the last definition like DuplicateLastWins. A later
+	// definition of null removes the key. It's useful for documents made by
+	// concatenating fragments.
+	DuplicateMerge
+)
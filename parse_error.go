@@ -1,6 +1,7 @@
 package confl
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"unicode/utf8"
@@ -12,17 +13,54 @@ type ParseError struct {
 	// msg is the error message
 	msg string
 
-	// src is the source around where the error happened
+	// src is the source of the document, or the window of it that was in
+	// memory when parsing from a stream
 	src []byte
 
+	// base is the offset within the document of the start of src
+	base int
+
+	// baseLine is the number of lines in the document before the start of
+	// src
+	baseLine int
+
 	// offset is the offset in src where the error happened
 	offset int
 
 	// length is the length of the token where the error happened
 	length int
 
-	// line is the line for the error
-	line int
+	// filename is the name of the file being parsed, if known
+	filename string
+
+	// code identifies the kind of error
+	code ErrorCode
+
+	// suggestion is a suggested fix for the error, if there is one
+	suggestion string
+
+	// related are other locations related to the error
+	related []Location
+
+	// document is the number of the document in a stream where the error
+	// happened, or 0 if it isn't from a stream
+	document int
+}
+
+// Location is a position in a document related to a ParseError
+type Location struct {
+
+	// Message describes the location
+	Message string `json:"message"`
+
+	// Offset is the byte offset of the location in the document
+	Offset int `json:"offset"`
+
+	// Line is the line number of the location, starting at 1
+	Line int `json:"line"`
+
+	// Column is the character offset within the line, starting at 1
+	Column int `json:"column"`
 }
 
 // Error returns the error message
@@ -30,66 +68,372 @@ func (p *ParseError) Error() string {
 	return p.msg
 }
 
+// Line returns the line number where the error occurred, starting at 1
+func (p *ParseError) Line() int {
+	return p.lineOf(p.offset)
+}
+
+// Column returns the character offset within the line where the error
+// occurred, starting at 1
+func (p *ParseError) Column() int {
+	return p.columnOf(p.offset)
+}
+
+// EndLine returns the line number where the error ends, starting at 1
+func (p *ParseError) EndLine() int {
+	return p.lineOf(p.end())
+}
+
+// EndColumn returns the character offset within the line just past where the
+// error ends, starting at 1
+func (p *ParseError) EndColumn() int {
+	return p.columnOf(p.end())
+}
+
+// end returns the offset just past the error
+func (p *ParseError) end() int {
+	return spanEnd(p.src, p.offset, p.length)
+}
+
+// spanEnd returns the offset just past a span of src. Spans without a length
+// cover a single character, unless they're at the end of a line.
+func spanEnd(src []byte, offset, length int) int {
+	end := offset + length
+	if length == 0 && end < len(src) && src[end] != '\n' {
+		_, w := utf8.DecodeRune(src[end:])
+		end += w
+	}
+
+	return end
+}
+
+// Offset returns the byte offset in the document where the error occurred
+func (p *ParseError) Offset() int {
+	return p.base + p.offset
+}
+
+// Filename returns the name of the file where the error occurred, or the
+// empty string if it isn't known
+func (p *ParseError) Filename() string {
+	return p.filename
+}
+
+// Document returns the number of the document in a stream where the error
+// occurred, starting at 1, or 0 if the error isn't from a Decoder
+func (p *ParseError) Document() int {
+	return p.document
+}
+
+// Code returns the code identifying the kind of error
+func (p *ParseError) Code() ErrorCode {
+	return p.code
+}
+
+// Unwrap returns the error's code, so errors.Is can check for it
+func (p *ParseError) Unwrap() error {
+	return p.code
+}
+
+// Token returns the source text of the token where the error occurred
+func (p *ParseError) Token() string {
+	return string(p.src[p.offset:p.end()])
+}
+
+// Related returns other locations related to the error, such as where an
+// unclosed map was opened
+func (p *ParseError) Related() []Location {
+	return p.related
+}
+
+// Suggestion returns a suggested fix for the error, or the empty string if
+// there isn't one
+func (p *ParseError) Suggestion() string {
+	return p.suggestion
+}
+
 // ErrorWithCode returns a multi-line formatted version of the error including
 // the code where the error occurred.
 func (p *ParseError) ErrorWithCode() string {
+	start, end := p.lineStart(p.offset), p.lineEnd(p.offset)
 	focusEnd := p.offset + p.length
+	if focusEnd > end {
+		focusEnd = end
+	}
+
+	postEnd := focusEnd + 20
+	if postEnd > end {
+		postEnd = end
+	}
 
-	line := fmt.Sprintf("Line %d: ", p.line)
-	pre := string(p.src[0:p.offset])
+	line := fmt.Sprintf("Line %d: ", p.Line())
+	pre := string(p.src[start:p.offset])
 	focus := string(p.src[p.offset:focusEnd])
-	post := string(p.src[focusEnd:len(p.src)])
+	post := string(p.src[focusEnd:postEnd])
+
+	// if offset is EOF, show it
+	if p.offset == len(p.src) {
+		focus = "(EOF)"
+	}
+
+	tabWidth := defaultTabWidth
+	code, preWidth := expandTabs(pre, 0, tabWidth)
+	focus, focusWidth := expandTabs(focus, preWidth, tabWidth)
+	post, _ = expandTabs(post, preWidth+focusWidth, tabWidth)
+	if focusWidth == 0 {
+		focusWidth = 1
+	}
 
 	return fmt.Sprintf(
-		"%s\n%s%s%s%s\n%s%s%s%s\n",
+		"%s\n%s%s%s%s\n%s%s%s\n",
 		p.msg,
-		line, pre, focus, post,
+		line, code, focus, post,
 		strings.Repeat(" ", utf8.RuneCountInString(line)),
-		strings.Repeat(" ", utf8.RuneCountInString(pre)),
-		strings.Repeat("^", utf8.RuneCountInString(focus)),
-		strings.Repeat(" ", utf8.RuneCountInString(post)),
+		strings.Repeat(" ", preWidth),
+		strings.Repeat("^", focusWidth),
+	)
+}
+
+// CodeOptions configures how FormatCode renders an error
+type CodeOptions struct {
+
+	// TabWidth is the number of columns between tab stops. Zero means 4.
+	TabWidth int
+
+	// Context is the number of lines of code to show before and after the
+	// lines where the error occurred
+	Context int
+
+	// Color highlights the output with ANSI escape codes for terminals
+	Color bool
+}
+
+// ANSI escape codes used when rendering errors in color
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiBoldRed = "\x1b[1;31m"
+	ansiBlue    = "\x1b[34m"
+)
+
+// FormatCode returns a multi-line formatted version of the error with a
+// header giving the file, line and column, followed by the numbered lines of
+// code where the error occurred with the error underlined. Errors spanning
+// several lines underline every line they touch. Tabs are expanded, and wide
+// and combining characters are accounted for so the underline stays aligned.
+// Related locations follow as notes, each with its own line of code.
+func (p *ParseError) FormatCode(opts CodeOptions) string {
+	if opts.TabWidth <= 0 {
+		opts.TabWidth = defaultTabWidth
+	}
+
+	// the gutter fits the largest line number shown
+	end := p.end()
+	lastShown := p.lineOf(end) + opts.Context
+	if lines := p.lineOf(len(p.src)); lastShown > lines {
+		lastShown = lines
+	}
+	for _, loc := range p.related {
+		if loc.Line > lastShown {
+			lastShown = loc.Line
+		}
+	}
+	gutterWidth := len(fmt.Sprint(lastShown))
+
+	var b strings.Builder
+	fmt.Fprintf(
+		&b,
+		"%s%s\n",
+		colorize(opts.Color, ansiBoldRed, "error"),
+		colorize(opts.Color, ansiBold, ": "+p.msg),
 	)
+	p.writeCode(&b, opts, gutterWidth, p.offset, end)
+
+	noteOpts := opts
+	noteOpts.Context = 0
+	for _, loc := range p.related {
+		fmt.Fprintf(
+			&b,
+			"%s%s\n",
+			colorize(opts.Color, ansiBold, "note"),
+			colorize(opts.Color, ansiBold, ": "+loc.Message),
+		)
+		start := loc.Offset - p.base
+		p.writeCode(&b, noteOpts, gutterWidth, start, spanEnd(p.src, start, 0))
+	}
+
+	if p.suggestion != "" {
+		fmt.Fprintf(
+			&b,
+			"%s %s %s\n",
+			strings.Repeat(" ", gutterWidth),
+			colorize(opts.Color, ansiBlue, "="),
+			colorize(opts.Color, ansiBold, "help:")+" "+p.suggestion,
+		)
+	}
+
+	return b.String()
 }
 
-// newParseError returns a new parse error based on the given msg, scanner, and
-// offset
-func newParseError(msg string, scan *scanner, offset, length int) *ParseError {
-	start := scan.lineStart
-	if start < 0 {
-		start = 0
+// writeCode writes the location header and numbered lines of code for the
+// span from start to end, with the span underlined
+func (p *ParseError) writeCode(b *strings.Builder, opts CodeOptions, gutterWidth, start, end int) {
+	location := fmt.Sprintf("%d:%d", p.lineOf(start), p.columnOf(start))
+	if p.filename != "" {
+		location = p.filename + ":" + location
+	}
+	if p.document > 0 {
+		location += fmt.Sprintf(" (document %d)", p.document)
 	}
+	fmt.Fprintf(b, "%s %s %s\n", strings.Repeat(" ", gutterWidth-1), colorize(opts.Color, ansiBlue, "-->"), location)
 
-	// if the offset wraps lines, just go with the last line
-	if offset < start {
-		offset = start
+	// line numbers are counted within src
+	firstLine := p.lineOf(start) - p.baseLine
+	lastLine := p.lineOf(end) - p.baseLine
+	if end > start && p.src[end-1] == '\n' {
+		lastLine--
 	}
 
-	end := offset + length + 20
-	if end > len(scan.src) {
-		end = len(scan.src)
+	lines := bytes.Split(p.src, []byte("\n"))
+	from, to := firstLine-opts.Context, lastLine+opts.Context
+	if from < 1 {
+		from = 1
+	}
+	if to > len(lines) {
+		to = len(lines)
 	}
 
-	// length has to at least be 1 and less than end
-	if length == 0 {
-		length = 1
+	lineStart := 0
+	for i := 1; i < from; i++ {
+		lineStart += len(lines[i-1]) + 1
 	}
-	if offset+length > end {
-		length = end - offset
+
+	for n := from; n <= to; n++ {
+		text := string(bytes.TrimRight(lines[n-1], "\r"))
+		gutter := colorize(opts.Color, ansiBlue, fmt.Sprintf("%*d |", gutterWidth, p.baseLine+n))
+
+		if n < firstLine || n > lastLine {
+			code, _ := expandTabs(text, 0, opts.TabWidth)
+			fmt.Fprintln(b, strings.TrimRight(gutter+" "+code, " "))
+			lineStart += len(lines[n-1]) + 1
+			continue
+		}
+
+		// find the part of this line that's in the span
+		focusStart, focusEnd := start-lineStart, end-lineStart
+		if focusStart < 0 {
+			focusStart = 0
+		}
+		if focusEnd > len(text) {
+			focusEnd = len(text)
+		}
+
+		pre, preWidth := expandTabs(text[:focusStart], 0, opts.TabWidth)
+		focus, focusWidth := expandTabs(text[focusStart:focusEnd], preWidth, opts.TabWidth)
+		post, _ := expandTabs(text[focusEnd:], preWidth+focusWidth, opts.TabWidth)
+		if focusWidth == 0 {
+			focusWidth = 1
+		}
+
+		code := strings.TrimRight(pre+colorize(opts.Color, ansiBoldRed, focus)+post, " ")
+		fmt.Fprintf(b, "%s %s\n", gutter, code)
+		fmt.Fprintf(
+			b,
+			"%s %s%s\n",
+			colorize(opts.Color, ansiBlue, strings.Repeat(" ", gutterWidth)+" |"),
+			strings.Repeat(" ", preWidth),
+			colorize(opts.Color, ansiBoldRed, strings.Repeat("^", focusWidth)),
+		)
+
+		lineStart += len(lines[n-1]) + 1
 	}
+}
 
-	src := scan.src[start:end]
+// colorize wraps s in an ANSI escape code if on is true
+func colorize(on bool, code, s string) string {
+	if !on || s == "" {
+		return s
+	}
 
-	// if offset is EOF, show it
-	if offset == end {
-		src = append(src, []byte("(EOF)")...)
-		length = 5
+	return code + s + ansiReset
+}
+
+// lineOf returns the line number containing offset in src, starting at 1
+func (p *ParseError) lineOf(offset int) int {
+	return p.baseLine + bytes.Count(p.src[:offset], []byte("\n")) + 1
+}
+
+// columnOf returns the character offset of offset in src within its line,
+// starting at 1
+func (p *ParseError) columnOf(offset int) int {
+	return utf8.RuneCount(p.src[p.lineStart(offset):offset]) + 1
+}
+
+// lineStart returns the offset of the start of the line containing offset
+func (p *ParseError) lineStart(offset int) int {
+	return bytes.LastIndexByte(p.src[:offset], '\n') + 1
+}
+
+// lineEnd returns the offset of the end of the line containing offset, not
+// including the line break
+func (p *ParseError) lineEnd(offset int) int {
+	end := bytes.IndexByte(p.src[offset:], '\n')
+	if end < 0 {
+		return len(p.src)
+	}
+
+	return offset + end
+}
+
+// newParseError returns a new parse error based on the given code, msg,
+// scanner, and offset within the document. When parsing from a stream, an
+// offset from before the window of the source in memory is moved to its start.
+func newParseError(code ErrorCode, msg string, scan *scanner, offset, length int) *ParseError {
+	offset -= scan.base
+	if offset < 0 {
+		length += offset
+		offset = 0
+	}
+	if length < 0 {
+		length = 0
+	}
+	if offset > len(scan.src) {
+		offset = len(scan.src)
+	}
+	if offset+length > len(scan.src) {
+		length = len(scan.src) - offset
 	}
 
 	return &ParseError{
-		msg:    msg,
-		src:    src,
-		offset: offset - start,
-		length: length,
-		line:   scan.line,
+		msg:      msg,
+		src:      scan.src,
+		base:     scan.base,
+		baseLine: scan.baseLine,
+		offset:   offset,
+		length:   length,
+		filename: scan.opts.Filename,
+		code:     code,
 	}
 }
+
+// relate adds a related location at offset within the document to the error
+// and returns it. Locations from before the window of the source in memory
+// when parsing from a stream are left out.
+func (p *ParseError) relate(offset int, format string, args ...interface{}) *ParseError {
+	if offset < p.base {
+		return p
+	}
+
+	p.related = append(p.related, Location{
+		Message: fmt.Sprintf(format, args...),
+		Offset:  offset,
+		Line:    p.lineOf(offset - p.base),
+		Column:  p.columnOf(offset - p.base),
+	})
+	return p
+}
+
+// suggest sets the suggested fix for the error and returns it
+func (p *ParseError) suggest(format string, args ...interface{}) *ParseError {
+	p.suggestion = fmt.Sprintf(format, args...)
+	return p
+}
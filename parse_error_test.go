@@ -0,0 +1,246 @@
+package confl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		line   int
+		column int
+		offset int
+	}{
+		{"first line", `test=23 "also"=this}`, 1, 20, 19},
+		{"later line", "test=23\n  also=]", 2, 8, 15},
+		{"EOF", "test=23\nalso=", 2, 6, 13},
+		{"unicode before the error", "tëst=\"日本\" x=]", 1, 13, 17},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.src))
+			parseErr, ok := err.(*ParseError)
+			assert.True(t, ok)
+			assert.Equal(t, test.line, parseErr.Line())
+			assert.Equal(t, test.column, parseErr.Column())
+			assert.Equal(t, test.offset, parseErr.Offset())
+			assert.Equal(t, "", parseErr.Filename())
+		})
+	}
+}
+
+func TestParseErrorFilename(t *testing.T) {
+	_, err := ParseWithOptions(strings.NewReader("a=]"), Options{Filename: "test.confl"})
+	parseErr, ok := err.(*ParseError)
+	assert.True(t, ok)
+	assert.Equal(t, "test.confl", parseErr.Filename())
+	assert.Equal(
+		t,
+		"error: Illegal closing token: got ], expected EOF\n --> test.confl:1:3\n1 | a=]\n  |   ^\n  = help: remove the extra `]`\n",
+		parseErr.FormatCode(CodeOptions{}),
+	)
+}
+
+func TestParseErrorWithCode(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		code string
+	}{
+		{
+			"simple",
+			`test=23 "also"=this}`,
+			"Illegal closing token: got }, expected EOF\n" +
+				"Line 1: test=23 \"also\"=this}\n" +
+				"                           ^\n",
+		},
+		{
+			"tabs and wide characters",
+			"\tkey=\"日本\"\t]",
+			"Illegal closing token: got ], expected EOF\n" +
+				"Line 1:     key=\"日本\"  ]\n" +
+				"                        ^\n",
+		},
+		{
+			"EOF",
+			"key=",
+			"Illegal token, expected map value, got EOF\n" +
+				"Line 1: key=(EOF)\n" +
+				"            ^^^^^\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.src))
+			assert.Equal(t, test.code, err.(*ParseError).ErrorWithCode())
+		})
+	}
+}
+
+func TestParseErrorFormatCode(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		opts CodeOptions
+		code string
+	}{
+		{
+			"context lines",
+			"a=1\nb=2\nc=]\nd=4\ne=5",
+			CodeOptions{Context: 1},
+			"error: Illegal closing token: got ], expected EOF\n" +
+				" --> 3:3\n" +
+				"2 | b=2\n" +
+				"3 | c=]\n" +
+				"  |   ^\n" +
+				"4 | d=4\n" +
+				"  = help: remove the extra `]`\n",
+		},
+		{
+			"tab width and combining characters",
+			"\tke\u0301y=]",
+			CodeOptions{TabWidth: 2},
+			"error: Illegal closing token: got ], expected EOF\n" +
+				" --> 1:7\n" +
+				"1 |   ke\u0301y=]\n" +
+				"  |       ^\n" +
+				"  = help: remove the extra `]`\n",
+		},
+		{
+			"multi-line span",
+			"a=1\nb='one\ntwo",
+			CodeOptions{},
+			"error: Illegal token\n" +
+				" --> 2:3\n" +
+				"2 | b='one\n" +
+				"  |   ^^^^\n" +
+				"3 | two\n" +
+				"  | ^^^\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.src))
+			assert.Equal(t, test.code, err.(*ParseError).FormatCode(test.opts))
+		})
+	}
+}
+
+func TestParseErrorCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		code       ErrorCode
+		token      string
+		suggestion string
+	}{
+		{"illegal token", "a=1 b=:", ErrIllegalToken, ":", ""},
+		{"unexpected close", "a={b=1]", ErrUnexpectedClose, "]", "did you mean `}` to close the `{` opened at line 1?"},
+		{"extra close", "a=1}", ErrUnexpectedClose, "}", "remove the extra `}`"},
+		{"unclosed", "a=[1 2", ErrUnclosed, "", "add a closing `]` for the `[` opened at line 1"},
+		{"unclosed decorator", "a=dec(1 2)", ErrUnclosedDecorator, "2", "decorators hold a single value, use a list for several values"},
+		{"colon delimiter", "a : 1", ErrMissingDelimiter, ":", "did you mean `=`?"},
+		{"colon after key", "a: 1", ErrMissingDelimiter, "1", "did you mean `=`?"},
+		{"missing delimiter", "a 1", ErrMissingDelimiter, "1", "add `=` between the key and its value"},
+		{"missing value", "a=", ErrMissingValue, "", "add a value after `=`"},
+		{"empty decorator", "a=dec()", ErrMissingValue, "dec()", "add a value inside dec()"},
+		{"duplicate key", "a=1 a=2", ErrDuplicateKey, "a", "remove or rename one of the a keys"},
+		{"duplicate decorated key", "x=1 dec(a)=1 dec(a)=2", ErrDuplicateKey, "dec(a)", "remove or rename one of the dec(a) keys"},
+		{"null key", "null()=1", ErrNullKey, "null()", ""},
+		{"number key", "12=1", ErrNumberKey, "12", `quote the key to use it as a string: "12"`},
+		{"date key", "2019-05-01=1", ErrDateTimeKey, "2019-05-01", `quote the key to use it as a string: "2019-05-01"`},
+		{"map key", "{a=1}=1", ErrMapKey, "{", ""},
+		{"list key", "[a]=1", ErrListKey, "[", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.src))
+			assert.True(t, errors.Is(err, test.code))
+
+			var parseErr *ParseError
+			assert.True(t, errors.As(err, &parseErr))
+			assert.Equal(t, test.code, parseErr.Code())
+			assert.Equal(t, test.token, parseErr.Token())
+			assert.Equal(t, test.suggestion, parseErr.Suggestion())
+		})
+	}
+}
+
+func TestParseErrorRelated(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		related []Location
+	}{
+		{
+			"unclosed map",
+			"a={\n  b=1\n\n  # comment\nc=2\n",
+			[]Location{
+				{"`{` opened here", 2, 1, 3},
+				{"`{` may be missing a close before this line", 23, 5, 1},
+			},
+		},
+		{
+			"mismatched close",
+			"a={\n  b=[1 2\n  c\n}",
+			[]Location{
+				{"`[` opened here", 8, 2, 5},
+				{"`[` may be missing a close before this line", 15, 3, 3},
+			},
+		},
+		{
+			"close on the next line",
+			"a=[1 2\n}",
+			[]Location{{"`[` opened here", 2, 1, 3}},
+		},
+		{
+			"decorator",
+			"a=dec(1\n  2)",
+			[]Location{{"`dec(` opened here", 2, 1, 3}},
+		},
+		{
+			"duplicate key",
+			"a=1\nb=2\n  a=3",
+			[]Location{{"a first defined here", 0, 1, 1}},
+		},
+		{"extra close", "a=1}", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.src))
+			assert.Equal(t, test.related, err.(*ParseError).Related())
+		})
+	}
+}
+
+func TestParseErrorFormatCodeRelated(t *testing.T) {
+	src := "\n\n\n\n\n\n\n\na={\n  b=[1 2\n  c\n}"
+	_, err := ParseWithOptions(strings.NewReader(src), Options{Filename: "test.confl"})
+	assert.Equal(
+		t,
+		"error: Illegal closing token: got }, expected ]\n"+
+			"  --> test.confl:12:1\n"+
+			"12 | }\n"+
+			"   | ^\n"+
+			"note: `[` opened here\n"+
+			"  --> test.confl:10:5\n"+
+			"10 |   b=[1 2\n"+
+			"   |     ^\n"+
+			"note: `[` may be missing a close before this line\n"+
+			"  --> test.confl:11:3\n"+
+			"11 |   c\n"+
+			"   |   ^\n"+
+			"   = help: did you mean `]` to close the `[` opened at line 10?\n",
+		err.(*ParseError).FormatCode(CodeOptions{}),
+	)
+}
@@ -1,20 +1,170 @@
 package confl
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 )
 
+// nullDecorator is the decorator that, left empty, represents null
+const nullDecorator = "null"
+
 // Parse scans and parses from a reader
 func Parse(r io.Reader) (Node, error) {
+	return ParseWithOptions(r, Options{})
+}
+
+// ParseWithOptions scans and parses from a reader using the given options
+func ParseWithOptions(r io.Reader, opts Options) (Node, error) {
+	scan, err := scanReader(r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !scan.opts.AnyRoot || isImplicitMap(scan) {
+		return parseMap(scan, eofToken, "")
+	}
+
+	return parseRootValue(scan)
+}
+
+// ParseValue scans and parses a document from a reader that's a single value
+// of any type, such as a decorated value, rather than an implicit map
+func ParseValue(r io.Reader) (Node, error) {
+	scan, err := scanReader(r, Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRootValue(scan)
+}
+
+// ParseList scans and parses a document from a reader that's a single list
+func ParseList(r io.Reader) (Node, error) {
+	scan, err := scanReader(r, Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := parseRootValue(scan)
+	if err != nil {
+		return nil, err
+	}
+	if node.Type() != ListType {
+		return nil, newParseError(
+			ErrIllegalToken,
+			fmt.Sprintf("Illegal document, expected a list, got a %s", node.Type()),
+			scan,
+			scan.valueOffset,
+			0,
+		).suggest("surround the document with `[` and `]`")
+	}
+
+	return node, nil
+}
+
+// scanReader reads the source from r and returns a scanner for it
+func scanReader(r io.Reader, opts Options) (*scanner, error) {
+	if opts.MaxSize > 0 {
+		r = io.LimitReader(r, int64(opts.MaxSize)+1)
+	}
+
 	src, readErr := ioutil.ReadAll(r)
 	if readErr != nil {
 		return nil, readErr
 	}
 
 	scan := newScanner(src)
-	return parseMap(scan, eofToken, "")
+	scan.opts = opts
+	if opts.MaxSize > 0 && len(src) > opts.MaxSize {
+		return nil, newParseError(
+			ErrTooLarge,
+			fmt.Sprintf("Document is larger than the maximum of %d bytes", opts.MaxSize),
+			scan,
+			opts.MaxSize,
+			0,
+		)
+	}
+
+	return scan, nil
+}
+
+// parseRootValue parses a document that's a single value
+func parseRootValue(scan *scanner) (Node, error) {
+	node, err := parseValue(scan, false, eofToken, "")
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, newParseError(
+			ErrMissingValue,
+			"Illegal token, expected a value, got EOF",
+			scan,
+			scan.base+len(scan.src),
+			0,
+		)
+	}
+
+	// the value must be the whole document
+	token := scan.Token()
+	if !scan.isDocumentEnd(token.Type) {
+		return nil, newParseError(
+			ErrIllegalToken,
+			"Illegal token, expected EOF after the document's value",
+			scan,
+			token.Offset,
+			len(token.Content),
+		).suggest("a document with a single value can't have anything after it")
+	}
+
+	return node, nil
+}
+
+// isImplicitMap returns whether the document is empty or starts with a map
+// key followed by `=`, without consuming any tokens
+func isImplicitMap(scan *scanner) bool {
+	// when reading from a stream, the probe looks ahead without reading any
+	// further, so read ahead first
+	for scan.r != nil && len(scan.src)-scan.offset < compactSize && scan.fill() {
+	}
+
+	probe := *scan
+	probe.cst = nil
+	probe.r = nil
+
+	// skip any decorators around the key, then the key itself
+	decorators := 0
+	token := probe.Token()
+	for token.Type == decoratorStartToken {
+		decorators++
+		token = probe.Token()
+	}
+	if probe.isDocumentEnd(token.Type) {
+		return decorators == 0
+	}
+	if token.Type != wordToken && token.Type != stringToken {
+		return false
+	}
+
+	for ; decorators > 0; decorators-- {
+		if probe.Token().Type != decoratorEndToken {
+			return false
+		}
+	}
+
+	return probe.Token().Type == mapKVDelimToken
+}
+
+// definedKey is where a key in a map was defined
+type definedKey struct {
+
+	// offset is the offset of the key in the source
+	offset int
+
+	// index is the index of the key in the map's children
+	index int
 }
 
 // parseMap parses a map
@@ -24,37 +174,49 @@ func parseMap(
 	decorator string,
 ) (*mapNode, error) {
 	aMap := &mapNode{children: []Node{}, decorator: decorator}
-	keys := make(map[string]struct{})
+	keys := make(map[mapKey]definedKey)
 
 	for {
 		// scan the key
-		keyStart := scan.nextOffset
 		keyNode, keyErr := parseValue(scan, true, endDelim, "")
-		keyEnd := scan.nextOffset
+		keyStart, keyEnd := scan.valueOffset, scan.base+scan.offset
 		if keyErr != nil {
 			return nil, keyErr
 		}
 		if keyNode == nil {
 			return aMap, nil
 		}
-		if _, ok := keys[keyNode.Value()]; ok {
+
+		key := keyOf(keyNode)
+		first, duplicate := keys[key]
+		if duplicate && scan.opts.Duplicates == DuplicateError {
 			return nil, newParseError(
-				fmt.Sprintf("Duplicate key %s", keyNode.Value()),
+				ErrDuplicateKey,
+				fmt.Sprintf("Duplicate key %s", key),
 				scan,
 				keyStart,
 				keyEnd-keyStart,
-			)
+			).relate(
+				first.offset,
+				"%s first defined here",
+				key,
+			).suggest("remove or rename one of the %s keys", key)
 		}
 
 		// read the delimiter
 		delimToken := scan.Token()
 		if delimToken.Type != mapKVDelimToken {
-			return nil, newParseError(
+			err := newParseError(
+				ErrMissingDelimiter,
 				"Illegal token, expected map delimiter `=`",
 				scan,
 				delimToken.Offset,
 				len(delimToken.Content),
 			)
+			if err.Token() == ":" || strings.HasSuffix(keyNode.Value(), ":") {
+				return nil, err.suggest("did you mean `=`?")
+			}
+			return nil, err.suggest("add `=` between the key and its value")
 		}
 
 		// read and append the value
@@ -64,18 +226,68 @@ func parseMap(
 		}
 		if valNode == nil {
 			return nil, newParseError(
+				ErrMissingValue,
 				"Illegal token, expected map value, got EOF",
 				scan,
-				len(scan.src),
+				scan.base+len(scan.src),
 				0,
-			)
+			).suggest("add a value after `=`")
+		}
+
+		// when parsing events the tree isn't kept, and keys are only kept to
+		// report duplicates
+		if scan.events != nil {
+			if scan.opts.Duplicates == DuplicateError {
+				keys[key] = definedKey{offset: keyStart}
+			}
+			continue
+		}
+
+		if duplicate {
+			if mergeValue(aMap, first.index, keyNode, valNode, scan.opts.Duplicates) {
+				// the pair was removed, so later pairs have moved up
+				delete(keys, key)
+				for k, defined := range keys {
+					if defined.index > first.index {
+						defined.index -= 2
+						keys[k] = defined
+					}
+				}
+			}
+			continue
 		}
 
+		keys[key] = definedKey{offset: keyStart, index: len(aMap.children)}
 		aMap.children = append(aMap.children, keyNode, valNode)
-		keys[keyNode.Value()] = struct{}{}
 	}
 }
 
+// mergeValue combines a duplicate key and value into the pair at index in
+// aMap according to the policy, and returns whether the pair was removed,
+// which merging null does
+func mergeValue(aMap *mapNode, index int, key, val Node, policy DuplicatePolicy) bool {
+	if policy == DuplicateMerge && val.Type() == NullType {
+		aMap.children = append(aMap.children[:index], aMap.children[index+2:]...)
+		return true
+	}
+
+	dst, dstOk := aMap.children[index+1].(*mapNode)
+	src, srcOk := val.(*mapNode)
+	if policy == DuplicateMerge && dstOk && srcOk {
+		for _, pair := range KVPairs(src) {
+			if i := keyIndex(dst, keyOf(pair.Key)); i >= 0 {
+				mergeValue(dst, i-1, pair.Key, pair.Value, policy)
+			} else {
+				dst.children = append(dst.children, pair.Key, pair.Value)
+			}
+		}
+		return false
+	}
+
+	aMap.children[index], aMap.children[index+1] = key, val
+	return false
+}
+
 // parseList parses and returns a list
 func parseList(scan *scanner, decorator string) (*listNode, error) {
 	list := &listNode{children: []Node{}, decorator: decorator}
@@ -89,15 +301,20 @@ func parseList(scan *scanner, decorator string) (*listNode, error) {
 			return list, nil
 		}
 
-		list.children = append(list.children, node)
+		// when parsing events the tree isn't kept
+		if scan.events == nil {
+			list.children = append(list.children, node)
+		}
 	}
 }
 
-// parseDecoratorContents parses the node in a decorator
+// parseDecoratorContents parses the node in a decorator. The offset is the
+// offset of the decorator itself, for errors.
 func parseDecoratorContents(
 	scan *scanner,
 	mapKey bool,
 	decorator string,
+	offset int,
 ) (Node, error) {
 
 	node, err := parseValue(scan, mapKey, decoratorEndToken, decorator)
@@ -105,8 +322,47 @@ func parseDecoratorContents(
 		return nil, err
 	}
 
+	// only null may be empty, and the closing delimiter was already read
+	if node == nil {
+		if decorator != nullDecorator {
+			return nil, newParseError(
+				ErrMissingValue,
+				fmt.Sprintf("Decorator %s requires a value", decorator),
+				scan,
+				offset,
+				len(decorator)+2,
+			).suggest("add a value inside %s()", decorator)
+		}
+		if mapKey {
+			return nil, newParseError(
+				ErrNullKey,
+				"Nulls aren't allowed as map keys",
+				scan,
+				offset,
+				len(decorator)+2,
+			)
+		}
+
+		node := &valueNode{nodeType: NullType}
+		if err := scan.emit(EventValue, node, offset); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
 	// eat the closing decorator delimiter
-	scan.Token()
+	endToken := scan.Token()
+	if endToken.Type != decoratorEndToken {
+		err := newParseError(
+			ErrUnclosedDecorator,
+			"Illegal token, expected decorator end `)`",
+			scan,
+			endToken.Offset,
+			len(endToken.Content),
+		)
+		relateOpen(err, scan, endToken.Offset)
+		return nil, err.suggest("decorators hold a single value, use a list for several values")
+	}
 
 	return node, nil
 }
@@ -118,15 +374,23 @@ func parseValue(scan *scanner, mapKey bool, closeType tokenType, decorator strin
 
 	// read the value
 	token := scan.Token()
+	scan.valueOffset = token.Offset
 
 	switch {
-	case token.Type == closeType:
+	case token.Type == closeType || closeType == eofToken && scan.isDocumentEnd(token.Type):
 		return nil, nil
 	case token.Type == mapEndToken ||
 		token.Type == listEndToken ||
 		token.Type == decoratorEndToken ||
-		token.Type == eofToken:
-		return nil, newParseError(
+		token.Type == eofToken ||
+		token.Type == separatorToken:
+		code := ErrUnexpectedClose
+		if closeType != eofToken && scan.isDocumentEnd(token.Type) {
+			code = ErrUnclosed
+		}
+
+		err := newParseError(
+			code,
 			fmt.Sprintf(
 				"Illegal closing token: got %s, expected %s",
 				token.Type,
@@ -136,48 +400,175 @@ func parseValue(scan *scanner, mapKey bool, closeType tokenType, decorator strin
 			token.Offset,
 			len(token.Content),
 		)
+
+		if closeType == eofToken {
+			if token.Type == separatorToken {
+				return nil, err.suggest("use a Decoder to parse a stream of documents")
+			}
+			return nil, err.suggest("remove the extra `%s`", token.Type)
+		}
+
+		open, line := relateOpen(err, scan, token.Offset)
+		opened := ""
+		if line > 0 {
+			opened = fmt.Sprintf("the `%s` opened at line %d", openText(open), line)
+		}
+
+		switch {
+		case scan.isDocumentEnd(token.Type) && line > 0:
+			return nil, err.suggest("add a closing `%s` for %s", closeType, opened)
+		case scan.isDocumentEnd(token.Type):
+			return nil, err.suggest("add a closing `%s`", closeType)
+		case line > 0:
+			return nil, err.suggest("did you mean `%s` to close %s?", closeType, opened)
+		default:
+			return nil, err.suggest("did you mean `%s`?", closeType)
+		}
 	case token.Type == wordToken:
-		return &valueNode{
-			nodeType:  WordType,
+		nodeType := WordType
+		if _, ok := boolWords[token.Content]; ok && scan.opts.Bools && !mapKey {
+			nodeType = BoolType
+		}
+
+		node := &valueNode{
+			nodeType:  nodeType,
 			val:       token.Content,
 			decorator: decorator,
-		}, nil
+		}
+		return parsedScalar(scan, node, mapKey, token.Offset)
 	case token.Type == stringToken:
-		return &valueNode{
+		node := &valueNode{
 			nodeType:  StringType,
 			val:       token.Content,
 			decorator: decorator,
-		}, nil
+		}
+		return parsedScalar(scan, node, mapKey, token.Offset)
 	case token.Type == decoratorStartToken:
-		return parseDecoratorContents(scan, mapKey, token.Content)
+		if !decoratorAllowed(scan.opts, token.Content) {
+			err := newParseError(
+				ErrDecoratorNotAllowed,
+				fmt.Sprintf("Decorator %s isn't allowed", token.Content),
+				scan,
+				token.Offset,
+				len(token.Content)+1,
+			)
+			if len(scan.opts.Decorators) == 0 {
+				return nil, err.suggest("no decorators are allowed")
+			}
+			return nil, err.suggest("the allowed decorators are %s", strings.Join(scan.opts.Decorators, ", "))
+		}
+
+		start := scan.tokenIndex()
+		if err := openNested(scan, token); err != nil {
+			return nil, err
+		}
+		node, err := parseDecoratorContents(scan, mapKey, token.Content, token.Offset)
+		scan.opens = scan.opens[:len(scan.opens)-1]
+		if err != nil {
+			return nil, err
+		}
+		scan.valueOffset = token.Offset
+		scan.markNode(node, start)
+		return node, nil
 	case token.Type == numberToken:
 		if mapKey {
 			return nil, newParseError(
+				ErrNumberKey,
 				"Numbers aren't allowed as map keys",
 				scan,
 				token.Offset,
 				len(token.Content),
-			)
+			).suggest("quote the key to use it as a string: \"%s\"", token.Content)
+		}
+		if scan.opts.StrictNumbers && !strictNumberPattern.MatchString(token.Content) {
+			return nil, newParseError(
+				ErrInvalidNumber,
+				fmt.Sprintf("Number %s isn't in canonical form", token.Content),
+				scan,
+				token.Offset,
+				len(token.Content),
+			).suggest("remove leading zeros and trailing decimal points")
 		}
 
-		return &valueNode{
+		node := &valueNode{
 			nodeType:  NumberType,
 			val:       token.Content,
 			decorator: decorator,
-		}, nil
+		}
+		return parsedScalar(scan, node, mapKey, token.Offset)
+	case token.Type == dateToken ||
+		token.Type == timeToken ||
+		token.Type == dateTimeToken:
+		if mapKey {
+			return nil, newParseError(
+				ErrDateTimeKey,
+				"Dates and times aren't allowed as map keys",
+				scan,
+				token.Offset,
+				len(token.Content),
+			).suggest("quote the key to use it as a string: \"%s\"", token.Content)
+		}
+
+		node := &valueNode{
+			nodeType:  dateTimeNodeTypes[token.Type],
+			val:       token.Content,
+			decorator: decorator,
+		}
+		return parsedScalar(scan, node, mapKey, token.Offset)
+	case token.Type == sizeToken || token.Type == durationToken:
+		if mapKey {
+			return nil, newParseError(
+				ErrNumberKey,
+				"Numbers aren't allowed as map keys",
+				scan,
+				token.Offset,
+				len(token.Content),
+			).suggest("quote the key to use it as a string: \"%s\"", token.Content)
+		}
+
+		nodeType := SizeType
+		if token.Type == durationToken {
+			nodeType = DurationType
+		}
+
+		node := &valueNode{
+			nodeType:  nodeType,
+			val:       token.Content,
+			decorator: decorator,
+		}
+		return parsedScalar(scan, node, mapKey, token.Offset)
 	case token.Type == mapStartToken:
 		if mapKey {
 			return nil, newParseError(
+				ErrMapKey,
 				"Maps aren't allowed as map keys",
 				scan,
 				token.Offset,
 				len(token.Content),
 			)
 		}
-		return parseMap(scan, mapEndToken, decorator)
-	case token.Type == listStartToken && !mapKey:
+		start := scan.tokenIndex()
+		if err := openNested(scan, token); err != nil {
+			return nil, err
+		}
+		if err := scan.emitStart(EventMapStart, decorator, token.Offset); err != nil {
+			return nil, err
+		}
+		node, err := parseMap(scan, mapEndToken, decorator)
+		scan.opens = scan.opens[:len(scan.opens)-1]
+		if err != nil {
+			return nil, err
+		}
+		if err := scan.emit(EventEnd, node, scan.valueOffset); err != nil {
+			return nil, err
+		}
+		scan.valueOffset = token.Offset
+		scan.markNode(node, start)
+		return node, nil
+	case token.Type == listStartToken:
 		if mapKey {
 			return nil, newParseError(
+				ErrListKey,
 				"Lists aren't allowed as map keys",
 				scan,
 				token.Offset,
@@ -185,9 +576,27 @@ func parseValue(scan *scanner, mapKey bool, closeType tokenType, decorator strin
 			)
 		}
 
-		return parseList(scan, decorator)
+		start := scan.tokenIndex()
+		if err := openNested(scan, token); err != nil {
+			return nil, err
+		}
+		if err := scan.emitStart(EventListStart, decorator, token.Offset); err != nil {
+			return nil, err
+		}
+		node, err := parseList(scan, decorator)
+		scan.opens = scan.opens[:len(scan.opens)-1]
+		if err != nil {
+			return nil, err
+		}
+		if err := scan.emit(EventEnd, node, scan.valueOffset); err != nil {
+			return nil, err
+		}
+		scan.valueOffset = token.Offset
+		scan.markNode(node, start)
+		return node, nil
 	default:
 		return nil, newParseError(
+			ErrIllegalToken,
 			"Illegal token",
 			scan,
 			token.Offset,
@@ -195,3 +604,128 @@ func parseValue(scan *scanner, mapKey bool, closeType tokenType, decorator strin
 		)
 	}
 }
+
+// parsedScalar marks the node for a scalar value in the CST, emits its event,
+// and returns it
+func parsedScalar(scan *scanner, node Node, mapKey bool, offset int) (Node, error) {
+	scan.markNode(node, scan.tokenIndex())
+
+	eventType := EventValue
+	if mapKey {
+		eventType = EventKey
+	}
+	if err := scan.emit(eventType, node, offset); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// openNested pushes the token opening a map, list, or decorator onto the
+// stack of open tokens, and errors if that nests deeper than the options allow
+func openNested(scan *scanner, token token) error {
+	scan.opens = append(scan.opens, token)
+	if scan.opts.MaxDepth > 0 && len(scan.opens) > scan.opts.MaxDepth {
+		return newParseError(
+			ErrTooDeep,
+			fmt.Sprintf("Nesting is deeper than the maximum of %d", scan.opts.MaxDepth),
+			scan,
+			token.Offset,
+			len(openText(token)),
+		)
+	}
+
+	return nil
+}
+
+// decoratorAllowed returns whether the options allow the decorator
+func decoratorAllowed(opts Options, decorator string) bool {
+	if opts.Decorators == nil || decorator == nullDecorator {
+		return true
+	}
+
+	for _, allowed := range opts.Decorators {
+		if allowed == decorator {
+			return true
+		}
+	}
+
+	return false
+}
+
+// relateOpen adds the location of the innermost open map, list, or decorator
+// to err, along with the line it was likely meant to be closed before if the
+// indentation gives it away. It returns the opening token and the line it's
+// on, or 0 if that's no longer known when parsing from a stream. The offset
+// is the offset of the token where the close was expected.
+func relateOpen(err *ParseError, scan *scanner, offset int) (token, int) {
+	open := scan.opens[len(scan.opens)-1]
+	if open.Offset < scan.base {
+		return open, 0
+	}
+
+	err.relate(open.Offset, "`%s` opened here", openText(open))
+	line := err.related[len(err.related)-1].Line
+
+	if open.Type != decoratorStartToken {
+		culprit, ok := likelyClose(scan.src, open.Offset-scan.base, offset-scan.base)
+		if ok {
+			err.relate(scan.base+culprit, "`%s` may be missing a close before this line", openText(open))
+		}
+	}
+
+	return open, line
+}
+
+// openText returns the source text of an opening token
+func openText(open token) string {
+	switch open.Type {
+	case mapStartToken:
+		return "{"
+	case listStartToken:
+		return "["
+	default:
+		return open.Content + "("
+	}
+}
+
+// likelyClose returns the offset of the first line after the one containing
+// open, and before the one containing offset, that's indented no further than
+// the line containing open. That's usually the line that a missing close
+// belongs before. Blank lines and comments are skipped.
+func likelyClose(src []byte, open, offset int) (int, bool) {
+	lineStart := bytes.LastIndexByte(src[:open], '\n') + 1
+	indent := indentWidth(src[lineStart:])
+	limit := bytes.LastIndexByte(src[:offset], '\n') + 1
+
+	next := bytes.IndexByte(src[open:], '\n')
+	for next >= 0 {
+		lineStart = open + next + 1
+		if lineStart >= limit {
+			break
+		}
+
+		line := src[lineStart:]
+		if end := bytes.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+		}
+
+		content := bytes.TrimLeft(line, " \t\r")
+		if len(content) > 0 && content[0] != '#' && indentWidth(line) <= indent {
+			return lineStart + len(line) - len(content), true
+		}
+
+		open = lineStart
+		next = bytes.IndexByte(src[open:], '\n')
+	}
+
+	return 0, false
+}
+
+// indentWidth returns the width of the whitespace at the start of line, with
+// tabs expanded
+func indentWidth(line []byte) int {
+	content := bytes.TrimLeft(line, " \t")
+	_, width := expandTabs(string(line[:len(line)-len(content)]), 0, defaultTabWidth)
+	return width
+}
@@ -3,6 +3,7 @@ package confl
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -145,6 +146,62 @@ func TestParseScanner(t *testing.T) {
 			},
 			false,
 		},
+
+		{
+			"null",
+			`key=null() list=[null() 1]`,
+			&mapNode{
+				children: []Node{
+					&valueNode{nodeType: WordType, val: "key"},
+					&valueNode{nodeType: NullType},
+					&valueNode{nodeType: WordType, val: "list"},
+					&listNode{
+						children: []Node{
+							&valueNode{nodeType: NullType},
+							&valueNode{nodeType: NumberType, val: "1"},
+						},
+					},
+				},
+			},
+			false,
+		},
+
+		{
+			"dates and times",
+			`day=2019-05-01 at=10:30:00 expires=2019-05-01T10:30:00Z`,
+			&mapNode{
+				children: []Node{
+					&valueNode{nodeType: WordType, val: "day"},
+					&valueNode{nodeType: DateType, val: "2019-05-01"},
+					&valueNode{nodeType: WordType, val: "at"},
+					&valueNode{nodeType: TimeType, val: "10:30:00"},
+					&valueNode{nodeType: WordType, val: "expires"},
+					&valueNode{nodeType: DateTimeType, val: "2019-05-01T10:30:00Z"},
+				},
+			},
+			false,
+		},
+
+		{
+			"null as map key errors",
+			`null()=val`,
+			nil,
+			true,
+		},
+
+		{
+			"empty decorator errors",
+			`key=dec()`,
+			nil,
+			true,
+		},
+
+		{
+			"decorator with two values errors",
+			`key=dec(a b)`,
+			nil,
+			true,
+		},
 	}
 
 	for _, test := range tests {
@@ -156,3 +213,383 @@ func TestParseScanner(t *testing.T) {
 		})
 	}
 }
+
+func TestParseWithOptionsBools(t *testing.T) {
+	doc, err := ParseWithOptions(
+		bytes.NewReader([]byte(`enabled=yes mode=yes_please debug=FALSE true=dec(true)`)),
+		Options{Bools: true},
+	)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		&mapNode{
+			children: []Node{
+				&valueNode{nodeType: WordType, val: "enabled"},
+				&valueNode{nodeType: BoolType, val: "yes"},
+				&valueNode{nodeType: WordType, val: "mode"},
+				&valueNode{nodeType: WordType, val: "yes_please"},
+				&valueNode{nodeType: WordType, val: "debug"},
+				&valueNode{nodeType: BoolType, val: "FALSE"},
+				&valueNode{nodeType: WordType, val: "true"},
+				&valueNode{nodeType: BoolType, val: "true", decorator: "dec"},
+			},
+		},
+		doc,
+	)
+}
+
+func TestParseWithOptionsDuplicates(t *testing.T) {
+	src := `a={x=1 y={z=1}} b=2 a={y={w=2} x=3} b=dec(4)`
+
+	tests := []struct {
+		name   string
+		policy DuplicatePolicy
+		doc    *mapNode
+	}{
+		{
+			"last wins",
+			DuplicateLastWins,
+			&mapNode{
+				children: []Node{
+					&valueNode{nodeType: WordType, val: "a"},
+					&mapNode{
+						children: []Node{
+							&valueNode{nodeType: WordType, val: "y"},
+							&mapNode{
+								children: []Node{
+									&valueNode{nodeType: WordType, val: "w"},
+									&valueNode{nodeType: NumberType, val: "2"},
+								},
+							},
+							&valueNode{nodeType: WordType, val: "x"},
+							&valueNode{nodeType: NumberType, val: "3"},
+						},
+					},
+					&valueNode{nodeType: WordType, val: "b"},
+					&valueNode{nodeType: NumberType, val: "4", decorator: "dec"},
+				},
+			},
+		},
+		{
+			"merge",
+			DuplicateMerge,
+			&mapNode{
+				children: []Node{
+					&valueNode{nodeType: WordType, val: "a"},
+					&mapNode{
+						children: []Node{
+							&valueNode{nodeType: WordType, val: "x"},
+							&valueNode{nodeType: NumberType, val: "3"},
+							&valueNode{nodeType: WordType, val: "y"},
+							&mapNode{
+								children: []Node{
+									&valueNode{nodeType: WordType, val: "z"},
+									&valueNode{nodeType: NumberType, val: "1"},
+									&valueNode{nodeType: WordType, val: "w"},
+									&valueNode{nodeType: NumberType, val: "2"},
+								},
+							},
+						},
+					},
+					&valueNode{nodeType: WordType, val: "b"},
+					&valueNode{nodeType: NumberType, val: "4", decorator: "dec"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := ParseWithOptions(bytes.NewReader([]byte(src)), Options{Duplicates: test.policy})
+			assert.Nil(t, err)
+			assert.Equal(t, test.doc, doc)
+		})
+	}
+
+	_, err := Parse(bytes.NewReader([]byte(src)))
+	assert.Equal(t, ErrDuplicateKey, err.(*ParseError).Code())
+}
+
+func TestParseWithOptionsMergeNull(t *testing.T) {
+	doc, err := ParseWithOptions(
+		strings.NewReader(`a={b=1 c=2} d=1 a={b=null()} d=null() e=3 d=4`),
+		Options{Duplicates: DuplicateMerge},
+	)
+	assert.Nil(t, err)
+
+	expected, err := Parse(strings.NewReader(`a={c=2} e=3 d=4`))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, doc)
+
+	// null without an earlier definition is kept
+	doc, err = ParseWithOptions(strings.NewReader(`a=null()`), Options{Duplicates: DuplicateMerge})
+	assert.Nil(t, err)
+	assert.Equal(t, NullType, doc.Children()[1].Type())
+}
+
+func TestParseDecoratedKeys(t *testing.T) {
+	// keys with the same value and different decorators are different keys
+	doc, err := Parse(strings.NewReader(`device(wifi0)=1 host(wifi0)=2 wifi0=3`))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(doc.Children()))
+
+	_, err = Parse(strings.NewReader(`device(wifi0)=1 device(wifi0)=2`))
+	assert.Equal(t, "Duplicate key device(wifi0)", err.(*ParseError).msg)
+
+	// merging matches keys the same way
+	doc, err = ParseWithOptions(
+		strings.NewReader(`a={dev(x)=1 x=2} a={dev(x)=3}`),
+		Options{Duplicates: DuplicateMerge},
+	)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		[]Node{
+			&valueNode{nodeType: WordType, val: "x", decorator: "dev"},
+			&valueNode{nodeType: NumberType, val: "3"},
+			&valueNode{nodeType: WordType, val: "x"},
+			&valueNode{nodeType: NumberType, val: "2"},
+		},
+		doc.Children()[1].Children(),
+	)
+}
+
+func TestParseWithOptionsLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		src  string
+		err  ErrorCode
+	}{
+		{"max depth", Options{MaxDepth: 2}, `a={b=[1 2]}`, ""},
+		{"too deep", Options{MaxDepth: 2}, `a={b=[dec(1)]}`, ErrTooDeep},
+		{"max size", Options{MaxSize: 7}, `a=1 b=2`, ""},
+		{"too large", Options{MaxSize: 6}, `a=1 b=2`, ErrTooLarge},
+		{"allowed decorator", Options{Decorators: []string{"path"}}, `a=path("/etc") b=null()`, ""},
+		{"decorator not allowed", Options{Decorators: []string{"path"}}, `a=dev(wifi0)`, ErrDecoratorNotAllowed},
+		{"no decorators allowed", Options{Decorators: []string{}}, `a=path("/etc")`, ErrDecoratorNotAllowed},
+		{"strict numbers", Options{StrictNumbers: true}, `a=0 b=10.25 c=0x12`, ""},
+		{"leading zero", Options{StrictNumbers: true}, `a=007`, ErrInvalidNumber},
+		{"trailing decimal", Options{StrictNumbers: true}, `a=1.`, ErrInvalidNumber},
+		{"lenient numbers", Options{}, `a=007 b=1.`, ""},
+		{"implicit map root", Options{}, `[1 2]`, ErrListKey},
+		{"any root", Options{AnyRoot: true}, `[1 2]`, ""},
+		{"any root map", Options{AnyRoot: true}, `dec("a")=1 b=2`, ""},
+		{"any root trailing value", Options{AnyRoot: true}, `[1 2] [3]`, ErrIllegalToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseWithOptions(bytes.NewReader([]byte(test.src)), test.opts)
+			if test.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.Equal(t, test.err, err.(*ParseError).Code())
+			}
+		})
+	}
+}
+
+func TestParseWithOptionsDecoratorSuggestions(t *testing.T) {
+	_, err := ParseWithOptions(strings.NewReader(`a=dev(wifi0)`), Options{Decorators: []string{"path", "host"}})
+	assert.Equal(t, "the allowed decorators are path, host", err.(*ParseError).Suggestion())
+
+	_, err = ParseWithOptions(strings.NewReader(`a=dev(wifi0)`), Options{Decorators: []string{}})
+	assert.Equal(t, "no decorators are allowed", err.(*ParseError).Suggestion())
+}
+
+func TestParseWithOptionsAnyRoot(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		doc  Node
+	}{
+		{
+			"list",
+			`[hosts 2]`,
+			&listNode{
+				children: []Node{
+					&valueNode{nodeType: WordType, val: "hosts"},
+					&valueNode{nodeType: NumberType, val: "2"},
+				},
+			},
+		},
+		{
+			"decorated value",
+			`path("/etc")`,
+			&valueNode{nodeType: StringType, val: "/etc", decorator: "path"},
+		},
+		{
+			"null",
+			`null()`,
+			&valueNode{nodeType: NullType},
+		},
+		{
+			"implicit map",
+			`a=1`,
+			&mapNode{
+				children: []Node{
+					&valueNode{nodeType: WordType, val: "a"},
+					&valueNode{nodeType: NumberType, val: "1"},
+				},
+			},
+		},
+		{
+			"empty",
+			``,
+			&mapNode{children: []Node{}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := ParseWithOptions(bytes.NewReader([]byte(test.src)), Options{AnyRoot: true})
+			assert.Nil(t, err)
+			assert.Equal(t, test.doc, doc)
+		})
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		doc  Node
+		err  ErrorCode
+	}{
+		{
+			"decorated value",
+			`device(wifi0)`,
+			&valueNode{nodeType: WordType, val: "wifi0", decorator: "device"},
+			"",
+		},
+		{
+			"map",
+			`{a=1}`,
+			&mapNode{
+				children: []Node{
+					&valueNode{nodeType: WordType, val: "a"},
+					&valueNode{nodeType: NumberType, val: "1"},
+				},
+			},
+			"",
+		},
+		{"implicit map", `a=1`, nil, ErrIllegalToken},
+		{"empty", ``, nil, ErrMissingValue},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := ParseValue(bytes.NewReader([]byte(test.src)))
+			if test.err == "" {
+				assert.Nil(t, err)
+				assert.Equal(t, test.doc, doc)
+			} else {
+				assert.Equal(t, test.err, err.(*ParseError).Code())
+			}
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	doc, err := ParseList(bytes.NewReader([]byte("# hosts\n[mail.confl.org web.confl.org]\n")))
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		&listNode{
+			children: []Node{
+				&valueNode{nodeType: WordType, val: "mail.confl.org"},
+				&valueNode{nodeType: WordType, val: "web.confl.org"},
+			},
+		},
+		doc,
+	)
+
+	_, err = ParseList(bytes.NewReader([]byte("\n  {a=1}")))
+	assert.Equal(t, ErrIllegalToken, err.(*ParseError).Code())
+	assert.Equal(t, 2, err.(*ParseError).Line())
+	assert.Equal(t, 3, err.(*ParseError).Column())
+}
+
+// benchmarkDocuments are representative documents for benchmarks
+var benchmarkDocuments = []struct {
+	name string
+	src  string
+}{
+	{
+		"wifi",
+		`# Simple wifi configuration
+device(wifi0)={
+  network="Pretty fly for a wifi"
+  key="Some long wpa key"
+  dhcp=true
+
+  dns=["10.0.0.1" "10.0.0.2"]
+  gateway="10.0.0.1"
+
+  vpn={host="12.12.12.12" user=frank pass=secret key=path("/etc/vpn.key")}
+}
+`,
+	},
+	{"hosts", generatedDoc(500)},
+	{"escapes", escapedDoc(100)},
+}
+
+// escapedDoc returns a document with n lines of strings holding escapes
+func escapedDoc(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `motd%d="Welcome to \"confl\"" path%d='C:\\confl\\%d'`+"\n", i, i, i)
+	}
+
+	return b.String()
+}
+
+func BenchmarkScanner(b *testing.B) {
+	for _, doc := range benchmarkDocuments {
+		src := []byte(doc.src)
+		b.Run(doc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(doc.src)))
+			for i := 0; i < b.N; i++ {
+				scan := newScanner(src)
+				for token := scan.Token(); token.Type != eofToken; token = scan.Token() {
+					if token.Type == illegalToken {
+						b.Fatal(token.Content)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, doc := range benchmarkDocuments {
+		b.Run(doc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(doc.src)))
+			for i := 0; i < b.N; i++ {
+				if _, err := Parse(strings.NewReader(doc.src)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParseEvents(b *testing.B) {
+	for _, doc := range benchmarkDocuments {
+		b.Run(doc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(doc.src)))
+			for i := 0; i < b.N; i++ {
+				err := ParseEvents(strings.NewReader(doc.src), Options{}, func(e Event) error {
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
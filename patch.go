@@ -0,0 +1,491 @@
+package confl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// patchOp is a single parsed operation out of a patch
+type patchOp struct {
+
+	// op is the name of the operation
+	op string
+
+	// path is the target path of the operation
+	path []mapKey
+
+	// from is the source path for move and copy operations
+	from []mapKey
+
+	// value is the value for add, replace and test operations
+	value Node
+}
+
+// ApplyPatch applies a patch to a document and returns the patched document.
+// The document passed in is left untouched, and any part of the document that
+// isn't along the path of an operation is shared with the result.
+//
+// A patch is a list of maps, each describing a single operation. A patch may
+// also be given as a document with the list stored under the `patch` key:
+//
+//	patch=[
+//		{op=replace path="/device/network" value="Another wifi"}
+//		{op=add path="/device/dns/-" value="10.0.0.3"}
+//		{op=remove path="/device/key"}
+//		{op=move from="/device/gateway" path="/device/router"}
+//		{op=test path="/device/dhcp" value=true}
+//	]
+//
+// The supported operations are add, remove, replace, move, copy and test,
+// with the same meaning as in JSON Patch. Paths address nodes by map key or
+// list index, separated by `/`. A decorated key is written with its
+// decorator, like `/device(wifi0)/network`, and a key without one only
+// matches an undecorated key. A `/` within a key is written as `~1`, a `~` as
+// `~0`, a `(` as `~2`, and a `)` as `~3`. The path `-` appends to the end of
+// a list.
+//
+// Operations are applied in order, and if any operation fails no changes are
+// made and the error reports which operation failed.
+func ApplyPatch(doc Node, patch Node) (Node, error) {
+	ops, err := parsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, fmt.Errorf("Patch operation %d (%s): %s", i, op.op, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// parsePatch parses the operations out of a patch node
+func parsePatch(patch Node) ([]*patchOp, error) {
+	if patch.Type() == MapType {
+		list, _ := mapValue(patch, "patch")
+		if list == nil {
+			return nil, fmt.Errorf("Patch document has no patch key")
+		}
+		patch = list
+	}
+
+	if patch.Type() != ListType {
+		return nil, fmt.Errorf("Patch must be a list of operations")
+	}
+
+	ops := []*patchOp{}
+	for i, child := range patch.Children() {
+		op, err := parsePatchOp(child)
+		if err != nil {
+			return nil, fmt.Errorf("Patch operation %d: %s", i, err)
+		}
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+// parsePatchOp parses a single patch operation
+func parsePatchOp(n Node) (*patchOp, error) {
+	if n.Type() != MapType {
+		return nil, fmt.Errorf("Operation must be a map")
+	}
+
+	op := &patchOp{}
+	var hasPath, hasFrom bool
+
+	for _, pair := range KVPairs(n) {
+		var err error
+
+		switch pair.Key.Value() {
+		case "op":
+			if !IsText(pair.Value) {
+				return nil, fmt.Errorf("Operation op must be a word or string")
+			}
+			op.op = pair.Value.Value()
+		case "path":
+			hasPath = true
+			op.path, err = parsePatchPath(pair.Value)
+		case "from":
+			hasFrom = true
+			op.from, err = parsePatchPath(pair.Value)
+		case "value":
+			op.value = pair.Value
+		default:
+			return nil, fmt.Errorf("Unknown operation key %s", pair.Key.Value())
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.op {
+	case "add", "replace", "test":
+		if op.value == nil {
+			return nil, fmt.Errorf("Operation %s requires a value", op.op)
+		}
+	case "move", "copy":
+		if !hasFrom {
+			return nil, fmt.Errorf("Operation %s requires from", op.op)
+		}
+	case "remove":
+	case "":
+		return nil, fmt.Errorf("Operation requires op")
+	default:
+		return nil, fmt.Errorf("Unknown operation %s", op.op)
+	}
+
+	if !hasPath {
+		return nil, fmt.Errorf("Operation %s requires path", op.op)
+	}
+
+	return op, nil
+}
+
+// parsePatchPath splits a path node into its segments. The empty path refers
+// to the document itself and has no segments.
+func parsePatchPath(n Node) ([]mapKey, error) {
+	if !IsText(n) {
+		return nil, fmt.Errorf("Paths must be a word or string")
+	}
+
+	path := n.Value()
+	if path == "" {
+		return []mapKey{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("Path %s must begin with /", path)
+	}
+
+	segs := []mapKey{}
+	for _, seg := range strings.Split(path[1:], "/") {
+		segs = append(segs, parsePathSegment(seg))
+	}
+
+	return segs, nil
+}
+
+// apply applies the operation to doc
+func (op *patchOp) apply(doc Node) (Node, error) {
+	switch op.op {
+	case "add":
+		return patchAdd(doc, op.path, op.value)
+	case "remove":
+		return patchRemove(doc, op.path)
+	case "replace":
+		return patchReplace(doc, op.path, op.value)
+	case "move":
+		if isPathPrefix(op.from, op.path) && len(op.from) != len(op.path) {
+			return nil, fmt.Errorf("Cannot move a node into itself")
+		}
+
+		val, err := patchGet(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = patchRemove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return patchAdd(doc, op.path, val)
+	case "copy":
+		val, err := patchGet(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return patchAdd(doc, op.path, val)
+	case "test":
+		val, err := patchGet(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !nodesEqual(val, op.value) {
+			return nil, fmt.Errorf("Test failed for %s", joinPatchPath(op.path))
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("Unknown operation %s", op.op)
+	}
+}
+
+// patchGet returns the node at the given path
+func patchGet(doc Node, path []mapKey) (Node, error) {
+	node := doc
+	for i, seg := range path {
+		child, err := childAt(node, seg)
+		if err != nil {
+			return nil, fmt.Errorf("%s at %s", err, joinPatchPath(path[:i+1]))
+		}
+		node = child
+	}
+
+	return node, nil
+}
+
+// patchAdd adds val at the given path, replacing an existing map value or
+// inserting into a list
+func patchAdd(doc Node, path []mapKey, val Node) (Node, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+
+	return updateAt(doc, path, func(parent Node, seg mapKey) (Node, error) {
+		switch parent.Type() {
+		case MapType:
+			children := copyChildren(parent)
+			if i := keyIndex(parent, seg); i >= 0 {
+				children[i] = val
+			} else {
+				children = append(children, newKeyNode(seg), val)
+			}
+			return withChildren(parent, children), nil
+		case ListType:
+			i := len(parent.Children())
+			if seg != (mapKey{value: "-"}) {
+				var err error
+				if i, err = listIndex(parent, seg, true); err != nil {
+					return nil, err
+				}
+			}
+
+			children := make([]Node, 0, len(parent.Children())+1)
+			children = append(children, parent.Children()[:i]...)
+			children = append(children, val)
+			children = append(children, parent.Children()[i:]...)
+			return withChildren(parent, children), nil
+		default:
+			return nil, fmt.Errorf("Cannot add to a value node")
+		}
+	})
+}
+
+// patchRemove removes the node at the given path
+func patchRemove(doc Node, path []mapKey) (Node, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("Cannot remove the document")
+	}
+
+	return updateAt(doc, path, func(parent Node, seg mapKey) (Node, error) {
+		var start, end int
+
+		switch parent.Type() {
+		case MapType:
+			i := keyIndex(parent, seg)
+			if i < 0 {
+				return nil, fmt.Errorf("Key %s not found", seg)
+			}
+			start, end = i-1, i+1
+		case ListType:
+			i, err := listIndex(parent, seg, false)
+			if err != nil {
+				return nil, err
+			}
+			start, end = i, i+1
+		default:
+			return nil, fmt.Errorf("Cannot remove from a value node")
+		}
+
+		children := make([]Node, 0, len(parent.Children())-(end-start))
+		children = append(children, parent.Children()[:start]...)
+		children = append(children, parent.Children()[end:]...)
+		return withChildren(parent, children), nil
+	})
+}
+
+// patchReplace replaces the existing node at the given path
+func patchReplace(doc Node, path []mapKey, val Node) (Node, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+
+	return updateAt(doc, path, func(parent Node, seg mapKey) (Node, error) {
+		var i int
+
+		switch parent.Type() {
+		case MapType:
+			if i = keyIndex(parent, seg); i < 0 {
+				return nil, fmt.Errorf("Key %s not found", seg)
+			}
+		case ListType:
+			var err error
+			if i, err = listIndex(parent, seg, false); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Cannot replace within a value node")
+		}
+
+		children := copyChildren(parent)
+		children[i] = val
+		return withChildren(parent, children), nil
+	})
+}
+
+// updateAt walks to the parent of the last segment in path, calls fn with it,
+// and rebuilds every node along the path with the result
+func updateAt(
+	node Node,
+	path []mapKey,
+	fn func(parent Node, seg mapKey) (Node, error),
+) (Node, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	child, err := childAt(node, path[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s at %s", err, joinPatchPath(path[:1]))
+	}
+
+	newChild, err := updateAt(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var i int
+	if node.Type() == MapType {
+		i = keyIndex(node, path[0])
+	} else {
+		i, _ = listIndex(node, path[0], false)
+	}
+
+	children := copyChildren(node)
+	children[i] = newChild
+	return withChildren(node, children), nil
+}
+
+// childAt returns the child of a map or list for the given path segment
+func childAt(node Node, seg mapKey) (Node, error) {
+	switch node.Type() {
+	case MapType:
+		i := keyIndex(node, seg)
+		if i < 0 {
+			return nil, fmt.Errorf("Key %s not found", seg)
+		}
+		return node.Children()[i], nil
+	case ListType:
+		i, err := listIndex(node, seg, false)
+		if err != nil {
+			return nil, err
+		}
+		return node.Children()[i], nil
+	default:
+		return nil, fmt.Errorf("Value nodes have no children")
+	}
+}
+
+// mapValue returns the value for an undecorated key in a map node, along with
+// its index in the map's children. If the key isn't found it returns nil and
+// -1.
+func mapValue(n Node, key string) (Node, int) {
+	i := keyIndex(n, mapKey{value: key})
+	if i < 0 {
+		return nil, -1
+	}
+
+	return n.Children()[i], i
+}
+
+// listIndex parses seg as an index into a list node. If end is true the index
+// may point just past the last item.
+func listIndex(n Node, seg mapKey, end bool) (int, error) {
+	i, err := strconv.Atoi(seg.value)
+	if err != nil || i < 0 || seg.decorator != "" ||
+		(seg.value != "0" && strings.HasPrefix(seg.value, "0")) {
+		return 0, fmt.Errorf("Illegal list index %s", seg)
+	}
+
+	max := len(n.Children())
+	if !end {
+		max--
+	}
+	if i > max {
+		return 0, fmt.Errorf("List index %s out of range", seg)
+	}
+
+	return i, nil
+}
+
+// copyChildren returns a copy of the children of n that's safe to modify
+func copyChildren(n Node) []Node {
+	return append([]Node{}, n.Children()...)
+}
+
+// withChildren returns a copy of a map or list node with new children
+func withChildren(n Node, children []Node) Node {
+	if n.Type() == MapType {
+		return &mapNode{children: children, decorator: n.Decorator()}
+	}
+
+	return &listNode{children: children, decorator: n.Decorator()}
+}
+
+// newKeyNode returns a node for a new map key, using a word when the key is
+// a valid word and a string otherwise
+func newKeyNode(key mapKey) Node {
+	if isWord(key.value) {
+		return &valueNode{nodeType: WordType, val: key.value, decorator: key.decorator}
+	}
+
+	return &valueNode{nodeType: StringType, val: key.value, decorator: key.decorator}
+}
+
+// isPathPrefix returns true if prefix is a prefix of path
+func isPathPrefix(prefix, path []mapKey) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// joinPatchPath joins path segments back into a path
+func joinPatchPath(path []mapKey) string {
+	var b strings.Builder
+	for _, seg := range path {
+		b.WriteString("/")
+		b.WriteString(seg.segment())
+	}
+
+	return b.String()
+}
+
+// nodesEqual returns true if two nodes are equal. Maps are compared without
+// regard to the order of their keys.
+func nodesEqual(a, b Node) bool {
+	if a.Type() != b.Type() ||
+		a.Decorator() != b.Decorator() ||
+		a.Value() != b.Value() ||
+		len(a.Children()) != len(b.Children()) {
+		return false
+	}
+
+	switch a.Type() {
+	case MapType:
+		for _, pair := range KVPairs(a) {
+			i := keyIndex(b, keyOf(pair.Key))
+			if i < 0 || !nodesEqual(pair.Value, b.Children()[i]) {
+				return false
+			}
+		}
+	case ListType:
+		for i, child := range a.Children() {
+			if !nodesEqual(child, b.Children()[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,224 @@
+package confl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyPatch(t *testing.T) {
+	doc := `
+		device={
+			network="Pretty fly for a wifi"
+			dhcp=true
+			dns=["10.0.0.1" "10.0.0.2"]
+			gateway="10.0.0.1"
+		}
+	`
+
+	tests := []struct {
+		name   string
+		patch  string
+		result string
+		err    bool
+	}{
+		{
+			"replace a map value",
+			`patch=[{op=replace path="/device/network" value="Another wifi"}]`,
+			`device={
+				network="Another wifi" dhcp=true
+				dns=["10.0.0.1" "10.0.0.2"] gateway="10.0.0.1"
+			}`,
+			false,
+		},
+		{
+			"add a map key",
+			`patch=[{op=add path="/device/key" value=secret}]`,
+			`device={
+				network="Pretty fly for a wifi" dhcp=true
+				dns=["10.0.0.1" "10.0.0.2"] gateway="10.0.0.1" key=secret
+			}`,
+			false,
+		},
+		{
+			"append to a list",
+			`patch=[{op=add path="/device/dns/-" value="10.0.0.3"}]`,
+			`device={
+				network="Pretty fly for a wifi" dhcp=true
+				dns=["10.0.0.1" "10.0.0.2" "10.0.0.3"] gateway="10.0.0.1"
+			}`,
+			false,
+		},
+		{
+			"insert into a list",
+			`patch=[{op=add path="/device/dns/0" value="10.0.0.3"}]`,
+			`device={
+				network="Pretty fly for a wifi" dhcp=true
+				dns=["10.0.0.3" "10.0.0.1" "10.0.0.2"] gateway="10.0.0.1"
+			}`,
+			false,
+		},
+		{
+			"remove a map key and list item",
+			`patch=[
+				{op=remove path="/device/network"}
+				{op=remove path="/device/dns/1"}
+			]`,
+			`device={dhcp=true dns=["10.0.0.1"] gateway="10.0.0.1"}`,
+			false,
+		},
+		{
+			"move a key",
+			`patch=[{op=move from="/device/gateway" path="/router"}]`,
+			`device={
+				network="Pretty fly for a wifi" dhcp=true
+				dns=["10.0.0.1" "10.0.0.2"]
+			}
+			router="10.0.0.1"`,
+			false,
+		},
+		{
+			"copy a key",
+			`patch=[{op=copy from="/device/dns" path="/dns"}]`,
+			`device={
+				network="Pretty fly for a wifi" dhcp=true
+				dns=["10.0.0.1" "10.0.0.2"] gateway="10.0.0.1"
+			}
+			dns=["10.0.0.1" "10.0.0.2"]`,
+			false,
+		},
+		{
+			"passing test",
+			`patch=[{op=test path="/device/dns" value=["10.0.0.1" "10.0.0.2"]}]`,
+			doc,
+			false,
+		},
+		{
+			"failing test",
+			`patch=[{op=test path="/device/dhcp" value=false}]`,
+			"",
+			true,
+		},
+		{
+			"key with an escaped slash",
+			`patch=[{op=add path="/a~1b" value=c}]`,
+			doc + `a/b=c`,
+			false,
+		},
+		{
+			"missing key",
+			`patch=[{op=replace path="/device/missing" value=1}]`,
+			"",
+			true,
+		},
+		{
+			"list index out of range",
+			`patch=[{op=remove path="/device/dns/2"}]`,
+			"",
+			true,
+		},
+		{
+			"move into itself",
+			`patch=[{op=move from="/device" path="/device/inner"}]`,
+			"",
+			true,
+		},
+		{
+			"unknown operation",
+			`patch=[{op=frob path="/device"}]`,
+			"",
+			true,
+		},
+		{
+			"missing value",
+			`patch=[{op=add path="/device/key"}]`,
+			"",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			docNode, err := Parse(strings.NewReader(doc))
+			assert.Nil(t, err)
+
+			patch, err := Parse(strings.NewReader(test.patch))
+			assert.Nil(t, err)
+
+			result, err := ApplyPatch(docNode, patch)
+			assert.Equal(t, test.err, err != nil)
+			if test.err {
+				return
+			}
+
+			expected, err := Parse(strings.NewReader(test.result))
+			assert.Nil(t, err)
+			assert.True(t, nodesEqual(expected, result))
+		})
+	}
+}
+
+func TestApplyPatchLeavesDocument(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`key=value list=[a b]`))
+	assert.Nil(t, err)
+
+	patch, err := Parse(strings.NewReader(
+		`patch=[{op=replace path="/key" value=other} {op=remove path="/list/0"}]`,
+	))
+	assert.Nil(t, err)
+
+	_, err = ApplyPatch(doc, patch)
+	assert.Nil(t, err)
+
+	orig, err := Parse(strings.NewReader(`key=value list=[a b]`))
+	assert.Nil(t, err)
+	assert.True(t, nodesEqual(orig, doc))
+}
+
+func TestApplyPatchDecoratedKeys(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`device(wifi0)={a=1} host(wifi0)={a=2} wifi0={a=3}`))
+	assert.Nil(t, err)
+
+	patch, err := Parse(strings.NewReader(`patch=[
+		{op=replace path="/host(wifi0)/a" value=20}
+		{op=add path="/device(wifi1)" value={a=4}}
+		{op=remove path="/wifi0"}
+		{op=test path="/device(wifi0)/a" value=1}
+	]`))
+	assert.Nil(t, err)
+
+	result, err := ApplyPatch(doc, patch)
+	assert.Nil(t, err)
+
+	expected, err := Parse(strings.NewReader(`device(wifi0)={a=1} host(wifi0)={a=20} device(wifi1)={a=4}`))
+	assert.Nil(t, err)
+	assert.True(t, nodesEqual(expected, result))
+
+	// keys without a decorator don't match decorated keys
+	patch, err = Parse(strings.NewReader(`patch=[{op=remove path="/wifi1"}]`))
+	assert.Nil(t, err)
+	_, err = ApplyPatch(result, patch)
+	assert.Equal(t, "Patch operation 0 (remove): Key wifi1 not found", err.Error())
+
+	assert.Equal(t, "dev(a~2b~1c~3)", PathSegment(&valueNode{nodeType: StringType, val: "a(b/c)", decorator: "dev"}))
+}
+
+func TestApplyPatchEscapedParens(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`dev("a)b")=1 "c)"=2 "d(e)"=3`))
+	assert.Nil(t, err)
+
+	patch, err := Parse(strings.NewReader(`patch=[
+		{op=replace path="/dev(a~3b)" value=10}
+		{op=remove path="/c~3"}
+		{op=test path="/d~2e~3" value=3}
+	]`))
+	assert.Nil(t, err)
+
+	result, err := ApplyPatch(doc, patch)
+	assert.Nil(t, err)
+
+	expected, err := Parse(strings.NewReader(`dev("a)b")=10 "d(e)"=3`))
+	assert.Nil(t, err)
+	assert.True(t, nodesEqual(expected, result))
+}
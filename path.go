@@ -0,0 +1,64 @@
+package confl
+
+import (
+	"strconv"
+	"strings"
+)
+
+// pathEscaper escapes the characters with a meaning in a path segment
+var pathEscaper = strings.NewReplacer("~", "~0", "/", "~1", "(", "~2", ")", "~3")
+
+// pathUnescaper reverses pathEscaper
+var pathUnescaper = strings.NewReplacer("~1", "/", "~2", "(", "~3", ")", "~0", "~")
+
+// PathSegment returns the segment of a path, like those of a patch, for a map
+// key. An undecorated key is its value, and a decorated key is written with
+// its decorator, like `device(wifi0)`, so it only matches that key. A `~`
+// within the key is written as `~0`, a `/` as `~1`, a `(` as `~2`, and a `)`
+// as `~3`.
+func PathSegment(key Node) string {
+	return keyOf(key).segment()
+}
+
+// PathChild returns the child of a map or list for a path segment as it's
+// written in a path, or nil if there isn't one. A segment for a map matches
+// only the key with the same decorator, and a segment for a list is an index.
+func PathChild(n Node, seg string) Node {
+	key := parsePathSegment(seg)
+
+	switch n.Type() {
+	case MapType:
+		if i := keyIndex(n, key); i >= 0 {
+			return n.Children()[i]
+		}
+	case ListType:
+		i, err := strconv.Atoi(key.value)
+		if err == nil && key.decorator == "" && i >= 0 && i < len(n.Children()) {
+			return n.Children()[i]
+		}
+	}
+
+	return nil
+}
+
+// segment returns the key as a path segment
+func (k mapKey) segment() string {
+	if k.decorator == "" {
+		return pathEscaper.Replace(k.value)
+	}
+
+	return pathEscaper.Replace(k.decorator) + "(" + pathEscaper.Replace(k.value) + ")"
+}
+
+// parsePathSegment parses a path segment as it's written in a path into the
+// key it matches
+func parsePathSegment(seg string) mapKey {
+	if i := strings.IndexByte(seg, '('); i > 0 && strings.HasSuffix(seg, ")") {
+		return mapKey{
+			decorator: pathUnescaper.Replace(seg[:i]),
+			value:     pathUnescaper.Replace(seg[i+1 : len(seg)-1]),
+		}
+	}
+
+	return mapKey{value: pathUnescaper.Replace(seg)}
+}
@@ -1,7 +1,12 @@
 package confl
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -11,6 +16,21 @@ const (
 	runeBOM rune = 0xFEFF
 )
 
+const (
+	// readSize is how much of the source is read at a time from a reader
+	readSize = 4096
+
+	// compactSize is how much of the source before the current line is kept
+	// when reading from a reader before it's discarded
+	compactSize = 32 * 1024
+
+	// maxInterned is the most strings interned when reading from a reader
+	maxInterned = 4096
+
+	// maxInternedLen is the length of the longest string interned
+	maxInternedLen = 64
+)
+
 // scanner is a scanner of Confl code
 type scanner struct {
 
@@ -20,27 +40,78 @@ type scanner struct {
 	// next offset within the document
 	nextOffset int
 
-	// src is the source of the document
+	// src is the source of the document. When reading from a reader it's a
+	// window of the source starting at base.
 	src []byte
 
+	// text is a copy of src as a string when all of the source is in memory,
+	// so token contents can share it rather than each being copied. Any token
+	// content that's kept keeps all of text in memory.
+	text string
+
+	// interned are the contents of tokens copied out of src when reading
+	// from a reader, so repeated keys share one string
+	interned map[string]string
+
+	// r is the reader the rest of the source is read from, or nil if src is
+	// all of it
+	r io.Reader
+
+	// readErr is the error from reading r, if any
+	readErr error
+
+	// limit is the offset within the document past which nothing more is
+	// read from r, or 0 for no limit
+	limit int
+
+	// base is the offset within the document of the start of src
+	base int
+
+	// baseLine is the number of lines in the document before the start of
+	// src
+	baseLine int
+
 	// ch is the current rune
 	ch rune
 
 	// err is the current error
 	err error
 
-	// line is the current line number
-	line int
-
 	// lineStart is the offset where the line started
 	lineStart int
+
+	// valueOffset is the offset where the most recently parsed value started
+	valueOffset int
+
+	// opens are the tokens that opened the maps, lists, and decorators being
+	// parsed, innermost last
+	opens []token
+
+	// documents notes that the source is a stream of documents split by
+	// separators, rather than a single document
+	documents bool
+
+	// events receives an event for each part of the document as it's parsed
+	// by ParseEvents, and is nil otherwise
+	events func(Event) error
+
+	// opts are the options for parsing
+	opts Options
+
+	// cst records every token and the span of each node when parsing a
+	// concrete syntax tree, and is nil otherwise
+	cst *cstRecorder
 }
 
 // next returns the next character from the scanner
 func (s *scanner) next() bool {
+	// read only as far as the next rune, so a stream that's still being
+	// written isn't waited on for more than it needs
+	for (s.nextOffset >= len(s.src) || !utf8.FullRune(s.src[s.nextOffset:])) && s.fill() {
+	}
+
 	if s.nextOffset < len(s.src) {
 		if s.ch == '\n' {
-			s.line++
 			s.lineStart = s.nextOffset
 		}
 
@@ -74,25 +145,115 @@ func (s *scanner) next() bool {
 
 // newScanner returns a new scanner based on the given source
 func newScanner(src []byte) *scanner {
-	return &scanner{src: src, line: 1}
+	return &scanner{src: src, text: string(src)}
+}
+
+// newReaderScanner returns a new scanner that reads its source from r as it
+// goes, keeping only a window of it in memory
+func newReaderScanner(r io.Reader) *scanner {
+	return &scanner{src: make([]byte, 0, readSize), r: r}
+}
+
+// fill reads more of the source from the reader, and returns whether there
+// may be more to read
+func (s *scanner) fill() bool {
+	if s.r == nil || s.limit > 0 && s.base+len(s.src) >= s.limit {
+		return false
+	}
+
+	if cap(s.src)-len(s.src) < readSize {
+		grown := make([]byte, len(s.src), 2*cap(s.src)+readSize)
+		copy(grown, s.src)
+		s.src = grown
+	}
+
+	buf := s.src[len(s.src):cap(s.src)]
+	if s.limit > 0 && len(buf) > s.limit-s.base-len(s.src) {
+		buf = buf[:s.limit-s.base-len(s.src)]
+	}
+
+	n, err := s.r.Read(buf)
+	s.src = s.src[:len(s.src)+n]
+	if err != nil {
+		if err != io.EOF {
+			s.readErr = err
+		}
+		s.r = nil
+	}
+
+	return true
+}
+
+// compact discards the source well before the current line when reading
+// from a reader, so memory use is bounded by the length of the longest line
+func (s *scanner) compact() {
+	if s.r == nil || s.cst != nil || s.lineStart < compactSize {
+		return
+	}
+
+	n := s.lineStart
+	s.baseLine += bytes.Count(s.src[:n], []byte("\n"))
+	s.base += n
+	s.src = s.src[:copy(s.src, s.src[n:])]
+	s.offset -= n
+	s.nextOffset -= n
+	s.lineStart = 0
+}
+
+// content returns the source from start to end as a string
+func (s *scanner) content(start, end int) string {
+	if end <= len(s.text) {
+		return s.text[start:end]
+	}
+
+	return s.intern(s.src[start:end])
+}
+
+// intern returns b as a string, reusing an earlier copy of the same string if
+// there is one
+func (s *scanner) intern(b []byte) string {
+	if str, ok := s.interned[string(b)]; ok {
+		return str
+	}
+
+	str := string(b)
+	if len(str) <= maxInternedLen && len(s.interned) < maxInterned {
+		if s.interned == nil {
+			s.interned = make(map[string]string)
+		}
+		s.interned[str] = str
+	}
+
+	return str
 }
 
 // Token returns the next token
-func (s *scanner) Token() *token {
+func (s *scanner) Token() token {
 	var token token
 
 	// advance to the first character if at the beginning of the source
-	if s.offset == 0 && !s.next() {
+	if s.base == 0 && s.nextOffset == 0 && !s.next() {
 		token.Type = illegalToken
-		return &token
+		return token
 	}
 
+	s.compact()
+
 	// TODO: handle BOM if at 0
 
-	for s.skipWhitespace() || s.skipComment() {
+	for {
+		start := s.offset
+		if s.skipWhitespace() {
+			s.record(CSTWhitespace, start)
+		} else if s.skipComment() {
+			s.record(CSTComment, start)
+		} else {
+			break
+		}
 	}
 
-	token.Offset = s.offset
+	start := s.offset
+	token.Offset = s.base + start
 	advance := false
 
 	switch {
@@ -122,6 +283,11 @@ func (s *scanner) Token() *token {
 		advance = true
 	case s.isStringDelim():
 		token.Type, token.Content = s.scanString()
+	case s.isSeparator():
+		token.Type, token.Content = separatorToken, "---"
+		s.next()
+		s.next()
+		advance = true
 	default:
 		token.Type = illegalToken
 	}
@@ -129,11 +295,15 @@ func (s *scanner) Token() *token {
 	if advance {
 		if !s.next() {
 			token.Type = illegalToken
-			token.Content = string(s.src[token.Offset:s.nextOffset])
+			token.Content = s.content(start, s.nextOffset)
 		}
 	}
 
-	return &token
+	if token.Type != eofToken && token.Type != illegalToken {
+		s.record(CSTSyntax, start)
+	}
+
+	return token
 }
 
 // isWhitespace returns whether the current ch is whitespace
@@ -164,6 +334,100 @@ func (s *scanner) isLetter() bool {
 	return s.ch >= 'a' && s.ch <= 'z' || s.ch >= 'A' && s.ch <= 'Z' || s.ch > utf8.RuneSelf && unicode.IsLetter(s.ch)
 }
 
+// isSeparator returns whether the current ch starts a `---` document
+// separator at the start of a line
+func (s *scanner) isSeparator() bool {
+	if s.ch != '-' || s.offset != s.lineStart {
+		return false
+	}
+
+	for len(s.src)-s.offset < 3 && s.fill() {
+	}
+	if !bytes.HasPrefix(s.src[s.offset:], separator) {
+		return false
+	}
+
+	// the rest of the line has to be read to know nothing else is on it
+	for bytes.IndexByte(s.src[s.offset:], '\n') < 0 && s.fill() {
+	}
+	return isSeparatorLine(s.src[s.offset:])
+}
+
+// separator is the text of a document separator
+var separator = []byte("---")
+
+// isSeparatorLine returns whether src starts with a `---` document separator,
+// which may only be followed on its line by whitespace or a comment
+func isSeparatorLine(src []byte) bool {
+	if !bytes.HasPrefix(src, separator) {
+		return false
+	}
+
+	for _, c := range src[len(separator):] {
+		switch c {
+		case ' ', '\t', '\r':
+		case '\n', '#':
+			return true
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// skipSeparators skips whitespace, comments, and document separators, and
+// returns whether there's anything left after them
+func (s *scanner) skipSeparators() bool {
+	if s.base == 0 && s.nextOffset == 0 && !s.next() {
+		return true
+	}
+
+	for {
+		s.compact()
+		if s.skipWhitespace() || s.skipComment() {
+			continue
+		}
+		if !s.isSeparator() {
+			return s.ch != runeEOF
+		}
+
+		s.next()
+		s.next()
+		s.next()
+	}
+}
+
+// skipDocument skips the rest of the current document, up to the separator
+// that ends it or the end of the source
+func (s *scanner) skipDocument() {
+	// back up to a separator that's just been scanned
+	if s.atSeparator() {
+		s.nextOffset = s.lineStart
+		s.ch = '\n'
+		s.next()
+		return
+	}
+
+	for s.ch != runeEOF && !s.isSeparator() {
+		if !s.next() {
+			s.ch, s.nextOffset = 0, s.offset+1
+		}
+		s.compact()
+	}
+}
+
+// atSeparator returns whether the scanner is at or just past a separator at
+// the start of the current line
+func (s *scanner) atSeparator() bool {
+	return s.offset <= s.lineStart+3 && isSeparatorLine(s.src[s.lineStart:])
+}
+
+// isDocumentEnd returns whether a token of type t ends a document
+func (s *scanner) isDocumentEnd(t tokenType) bool {
+	return t == eofToken || s.documents && t == separatorToken
+}
+
 // isStringDelim returns true if the character is a string delimiter
 func (s *scanner) isStringDelim() bool {
 	return s.ch == '"' || s.ch == '\''
@@ -188,7 +452,7 @@ func (s *scanner) skipComment() bool {
 	if s.ch == '#' {
 		skipped = true
 
-		for s.ch != '\n' {
+		for s.ch != '\n' && s.ch != runeEOF {
 			s.next()
 		}
 	}
@@ -203,27 +467,107 @@ func (s *scanner) scanNumber() (tokenType, string) {
 
 	for !s.isPunctuation() && !s.isWhitespace() {
 
+		// a - or : means this is actually a date or time
+		if (s.ch == '-' || s.ch == ':') && !seenDecimal {
+			return s.scanDateTime(startOff)
+		}
+
+		// a letter other than the x in 0x means this is a number with a unit
+		if s.isLetter() && (s.offset-startOff != 1 || (s.ch != 'x' && s.ch != 'X')) {
+			return s.scanUnitNumber(startOff)
+		}
+
 		if !s.isDigit() && s.ch != '.' {
 			// allow 0xN and 0XN for hex
 			if s.offset-startOff != 1 || (s.ch != 'x' && s.ch != 'X') {
-				return illegalToken, string(s.src[startOff:s.nextOffset])
+				return illegalToken, s.content(startOff, s.nextOffset)
 			}
 		}
 
 		if s.ch == '.' {
 			if seenDecimal {
-				return illegalToken, string(s.src[startOff:s.nextOffset])
+				return illegalToken, s.content(startOff, s.nextOffset)
 			}
 
 			seenDecimal = true
 		}
 
 		if !s.next() {
-			return illegalToken, string(s.src[startOff:s.nextOffset])
+			return illegalToken, s.content(startOff, s.nextOffset)
+		}
+	}
+
+	return numberToken, s.content(startOff, s.offset)
+}
+
+// scanUnitNumber scans a byte size or duration starting at startOff
+func (s *scanner) scanUnitNumber(startOff int) (tokenType, string) {
+	for !s.isPunctuation() && !s.isWhitespace() {
+		if !s.next() {
+			return illegalToken, s.content(startOff, s.nextOffset)
+		}
+	}
+
+	content := s.content(startOff, s.offset)
+	switch {
+	case sizePattern.MatchString(content):
+		return sizeToken, content
+	case durationPattern.MatchString(content):
+		if _, err := time.ParseDuration(content); err != nil {
+			return illegalToken, content
+		}
+		return durationToken, content
+	default:
+		return illegalToken, content
+	}
+}
+
+// dateTimeLayouts are the layouts for each of the date and time tokens, in
+// RFC 3339 format
+var dateTimeLayouts = []struct {
+	tokenType tokenType
+	pattern   *regexp.Regexp
+	layout    string
+}{
+	{
+		dateToken,
+		regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`),
+		dateLayout,
+	},
+	{
+		timeToken,
+		regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?$`),
+		timeLayout,
+	},
+	{
+		dateTimeToken,
+		regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[Tt]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})$`),
+		time.RFC3339Nano,
+	},
+}
+
+// scanDateTime scans an RFC 3339 date, time, or date and time starting at
+// startOff
+func (s *scanner) scanDateTime(startOff int) (tokenType, string) {
+	for !s.isPunctuation() && !s.isWhitespace() {
+		if !s.next() {
+			return illegalToken, s.content(startOff, s.nextOffset)
 		}
 	}
 
-	return numberToken, string(s.src[startOff:s.offset])
+	content := s.content(startOff, s.offset)
+	for _, dt := range dateTimeLayouts {
+		if !dt.pattern.MatchString(content) {
+			continue
+		}
+
+		if _, err := time.Parse(dt.layout, strings.ToUpper(content)); err != nil {
+			return illegalToken, content
+		}
+		return dt.tokenType, content
+	}
+
+	return illegalToken, content
 }
 
 // scanWord scans a word or a decorator
@@ -232,16 +576,16 @@ func (s *scanner) scanWord() (tokenType, string) {
 
 	for !s.isPunctuation() && !s.isWhitespace() {
 		if !s.next() {
-			return illegalToken, string(s.src[startOff:s.nextOffset])
+			return illegalToken, s.content(startOff, s.nextOffset)
 		}
 	}
 
-	content := string(s.src[startOff:s.offset])
+	content := s.content(startOff, s.offset)
 
 	// if we're on a (, this is a decorator and not a word
 	if s.ch == '(' {
 		if !s.next() {
-			return illegalToken, string(s.src[startOff:s.nextOffset])
+			return illegalToken, s.content(startOff, s.nextOffset)
 		}
 		return decoratorStartToken, content
 	}
@@ -253,16 +597,25 @@ func (s *scanner) scanWord() (tokenType, string) {
 func (s *scanner) scanString() (tokenType, string) {
 	delim := s.ch
 	startOff := s.offset
-	var content []byte
 	escape := false
 
+	// content is only built once an escape is seen, until then the string is
+	// the source itself
+	var content []byte
+	escaped := false
+
 	// skip the opening char
 	if !s.next() {
-		return illegalToken, string(s.src[startOff:s.nextOffset])
+		return illegalToken, s.content(startOff, s.nextOffset)
 	}
 	startOff++
 
 	for {
+		// an unterminated string runs to the end of the source
+		if s.ch == runeEOF {
+			return illegalToken, s.content(startOff-1, s.offset)
+		}
+
 		if s.ch == '\\' {
 			if escape {
 				escape = false
@@ -279,19 +632,28 @@ func (s *scanner) scanString() (tokenType, string) {
 			}
 		}
 
-		if !escape {
+		if escape && !escaped {
+			content = make([]byte, 0, 2*(s.offset-startOff)+16)
+			content = append(content, s.src[startOff:s.offset]...)
+			escaped = true
+		} else if !escape && escaped {
 			content = append(content, s.src[s.offset:s.nextOffset]...)
 		}
 
 		if !s.next() {
-			return illegalToken, string(s.src[startOff:s.nextOffset])
+			return illegalToken, s.content(startOff, s.nextOffset)
 		}
 	}
 
+	end := s.offset
+
 	// skip the ending char
 	if !s.next() {
-		return illegalToken, string(s.src[startOff:s.nextOffset])
+		return illegalToken, s.content(startOff, s.nextOffset)
 	}
 
-	return stringToken, string(content)
+	if escaped {
+		return stringToken, string(content)
+	}
+	return stringToken, s.content(startOff, end)
 }
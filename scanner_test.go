@@ -1,6 +1,7 @@
 package confl
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -44,6 +45,66 @@ func TestScan(t *testing.T) {
 			[]string{"0X3", ""},
 		},
 
+		{
+			"date",
+			[]byte("2019-05-01"),
+			[]tokenType{dateToken, eofToken},
+			[]string{"2019-05-01", ""},
+		},
+		{
+			"time",
+			[]byte("10:30:00.125"),
+			[]tokenType{timeToken, eofToken},
+			[]string{"10:30:00.125", ""},
+		},
+		{
+			"date and time",
+			[]byte("2019-05-01T10:30:00Z"),
+			[]tokenType{dateTimeToken, eofToken},
+			[]string{"2019-05-01T10:30:00Z", ""},
+		},
+		{
+			"date and time with offset",
+			[]byte("2019-05-01T10:30:00.5-05:00"),
+			[]tokenType{dateTimeToken, eofToken},
+			[]string{"2019-05-01T10:30:00.5-05:00", ""},
+		},
+		{
+			"illegal: date out of range",
+			[]byte("2019-13-01"),
+			[]tokenType{illegalToken},
+			[]string{"2019-13-01"},
+		},
+		{
+			"illegal: date and time without offset",
+			[]byte("2019-05-01T10:30:00"),
+			[]tokenType{illegalToken},
+			[]string{"2019-05-01T10:30:00"},
+		},
+		{
+			"byte size",
+			[]byte("512MiB"),
+			[]tokenType{sizeToken, eofToken},
+			[]string{"512MiB", ""},
+		},
+		{
+			"fractional byte size",
+			[]byte("1.5GB"),
+			[]tokenType{sizeToken, eofToken},
+			[]string{"1.5GB", ""},
+		},
+		{
+			"duration",
+			[]byte("2h30m"),
+			[]tokenType{durationToken, eofToken},
+			[]string{"2h30m", ""},
+		},
+		{
+			"illegal: unknown unit",
+			[]byte("12parsecs"),
+			[]tokenType{illegalToken},
+			[]string{"12parsecs"},
+		},
 		{
 			"illegal: two decimal number",
 			[]byte("1.2.3"),
@@ -130,12 +191,24 @@ func TestScan(t *testing.T) {
 			[]tokenType{stringToken, eofToken},
 			[]string{"a ' string", ""},
 		},
+		{
+			"string with escaped backslashes",
+			[]byte("'a \\\\ string \\\\'"),
+			[]tokenType{stringToken, eofToken},
+			[]string{"a \\ string \\", ""},
+		},
 		{
 			"string with line breaks",
 			[]byte("'a \nstring'"),
 			[]tokenType{stringToken, eofToken},
 			[]string{"a \nstring", ""},
 		},
+		{
+			"illegal: unterminated string",
+			[]byte("'a \nstring"),
+			[]tokenType{illegalToken},
+			[]string{"'a \nstring"},
+		},
 		{
 			"simple decorator",
 			[]byte("decorator(12)"),
@@ -215,3 +288,34 @@ func TestScan(t *testing.T) {
 		})
 	}
 }
+
+func TestScanSharesSource(t *testing.T) {
+	allocs := func(src string) float64 {
+		return testing.AllocsPerRun(10, func() {
+			s := newScanner([]byte(src))
+			for token := s.Token(); token.Type != eofToken; token = s.Token() {
+			}
+		})
+	}
+
+	// contents share the source, so scanning more of it costs nothing more
+	short := allocs(`key="value"`)
+	assert.Equal(t, short, allocs(strings.Repeat(`key="value" other=word `, 20)))
+
+	// except for strings with escapes, which are copied
+	assert.True(t, allocs(`key="escaped \" value"`) > short)
+}
+
+func TestScanInternsReaderContents(t *testing.T) {
+	s := newReaderScanner(strings.NewReader("a=[host host] b=[host]"))
+
+	hosts := 0
+	for token := s.Token(); token.Type != eofToken; token = s.Token() {
+		if token.Content == "host" {
+			hosts++
+		}
+	}
+
+	assert.Equal(t, 3, hosts)
+	assert.Equal(t, map[string]string{"a": "a", "b": "b", "host": "host"}, s.interned)
+}
@@ -0,0 +1,62 @@
+package confl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// dateLayout is the layout for date nodes
+	dateLayout = "2006-01-02"
+
+	// timeLayout is the layout for time nodes. Fractional seconds are
+	// accepted when parsing even though they aren't in the layout.
+	timeLayout = "15:04:05"
+
+	// timeFormatLayout is the layout for formatting time nodes, which keeps
+	// fractional seconds if there are any
+	timeFormatLayout = "15:04:05.999999999"
+)
+
+// dateTimeNodeTypes maps date and time tokens to their node types
+var dateTimeNodeTypes = map[tokenType]NodeType{
+	dateToken:     DateType,
+	timeToken:     TimeType,
+	dateTimeToken: DateTimeType,
+}
+
+// IsTime returns true if the node is a date, time, or date and time
+func IsTime(n Node) bool {
+	return n.Type() == DateType || n.Type() == TimeType || n.Type() == DateTimeType
+}
+
+// Time decodes a date, time, or date and time node into a time.Time. Dates
+// are midnight UTC on that date, and times are on January 1 of year 0 UTC.
+func Time(n Node) (time.Time, error) {
+	switch n.Type() {
+	case DateType:
+		return time.Parse(dateLayout, n.Value())
+	case TimeType:
+		return time.Parse(timeLayout, n.Value())
+	case DateTimeType:
+		return time.Parse(time.RFC3339Nano, strings.ToUpper(n.Value()))
+	default:
+		return time.Time{}, fmt.Errorf("Node is a %s, not a date or time", n.Type())
+	}
+}
+
+// FormatTime formats t as a literal of the given node type, which must be
+// DateType, TimeType, or DateTimeType
+func FormatTime(t time.Time, nodeType NodeType) (string, error) {
+	switch nodeType {
+	case DateType:
+		return t.Format(dateLayout), nil
+	case TimeType:
+		return t.Format(timeFormatLayout), nil
+	case DateTimeType:
+		return t.Format(time.RFC3339Nano), nil
+	default:
+		return "", fmt.Errorf("Cannot format a time as a %s", nodeType)
+	}
+}
@@ -0,0 +1,74 @@
+package confl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     Node
+		expected time.Time
+		err      bool
+	}{
+		{
+			"date",
+			&valueNode{nodeType: DateType, val: "2019-05-01"},
+			time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC),
+			false,
+		},
+		{
+			"time",
+			&valueNode{nodeType: TimeType, val: "10:30:15.25"},
+			time.Date(0, 1, 1, 10, 30, 15, 250000000, time.UTC),
+			false,
+		},
+		{
+			"date and time",
+			&valueNode{nodeType: DateTimeType, val: "2019-05-01t10:30:00+02:00"},
+			time.Date(2019, 5, 1, 8, 30, 0, 0, time.UTC),
+			false,
+		},
+		{
+			"not a time",
+			&valueNode{nodeType: StringType, val: "2019-05-01"},
+			time.Time{},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := Time(test.node)
+			assert.Equal(t, test.err, err != nil)
+			assert.True(t, test.expected.Equal(decoded))
+		})
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	tm := time.Date(2019, 5, 1, 10, 30, 15, 500000000, time.FixedZone("", -5*60*60))
+
+	tests := []struct {
+		name     string
+		nodeType NodeType
+		expected string
+		err      bool
+	}{
+		{"date", DateType, "2019-05-01", false},
+		{"time", TimeType, "10:30:15.5", false},
+		{"date and time", DateTimeType, "2019-05-01T10:30:15.5-05:00", false},
+		{"not a time type", WordType, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formatted, err := FormatTime(tm, test.nodeType)
+			assert.Equal(t, test.err, err != nil)
+			assert.Equal(t, test.expected, formatted)
+		})
+	}
+}
@@ -39,6 +39,24 @@ const (
 
 	// decoratorEndToken represents the end of a decorator
 	decoratorEndToken
+
+	// dateToken represents a date token
+	dateToken
+
+	// timeToken represents a time of day token
+	timeToken
+
+	// dateTimeToken represents a date and time token
+	dateTimeToken
+
+	// sizeToken represents a number with a byte size unit
+	sizeToken
+
+	// durationToken represents a number with a duration unit
+	durationToken
+
+	// separatorToken represents a `---` separating documents in a stream
+	separatorToken
 )
 
 // typeString converts a token type to a string
@@ -52,6 +70,8 @@ func (t tokenType) String() string {
 		return "}"
 	case eofToken:
 		return "EOF"
+	case separatorToken:
+		return "---"
 	default:
 		panic("Cannot convert token type")
 	}
@@ -0,0 +1,69 @@
+package confl
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"time"
+)
+
+var (
+	// sizePattern matches a byte size, such as 512MiB or 1.5GB
+	sizePattern = regexp.MustCompile(`^(\d+(\.\d+)?)([KMGTP]i?)?B$`)
+
+	// durationPattern matches a duration, such as 250ms or 2h30m
+	durationPattern = regexp.MustCompile(`^(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+$`)
+)
+
+// sizeUnits are the multipliers for each byte size unit prefix
+var sizeUnits = map[string]int64{
+	"":   1,
+	"K":  1000,
+	"M":  1000 * 1000,
+	"G":  1000 * 1000 * 1000,
+	"T":  1000 * 1000 * 1000 * 1000,
+	"P":  1000 * 1000 * 1000 * 1000 * 1000,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+	"Pi": 1 << 50,
+}
+
+// ByteSize decodes a size node into a number of bytes. Sizes may be
+// fractional, like 1.5KiB, so long as they come out to a whole number of
+// bytes.
+func ByteSize(n Node) (int64, error) {
+	if n.Type() != SizeType {
+		return 0, fmt.Errorf("Node is a %s, not a size", n.Type())
+	}
+
+	match := sizePattern.FindStringSubmatch(n.Value())
+	if match == nil {
+		return 0, fmt.Errorf("Illegal size %s", n.Value())
+	}
+
+	size, ok := new(big.Rat).SetString(match[1])
+	if !ok {
+		return 0, fmt.Errorf("Illegal size %s", n.Value())
+	}
+	size.Mul(size, new(big.Rat).SetInt64(sizeUnits[match[3]]))
+
+	if !size.IsInt() {
+		return 0, fmt.Errorf("Size %s is not a whole number of bytes", n.Value())
+	}
+	if !size.Num().IsInt64() {
+		return 0, fmt.Errorf("Size %s is too large", n.Value())
+	}
+
+	return size.Num().Int64(), nil
+}
+
+// Duration decodes a duration node into a time.Duration
+func Duration(n Node) (time.Duration, error) {
+	if n.Type() != DurationType {
+		return 0, fmt.Errorf("Node is a %s, not a duration", n.Type())
+	}
+
+	return time.ParseDuration(n.Value())
+}
@@ -0,0 +1,46 @@
+package confl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     Node
+		expected int64
+		err      bool
+	}{
+		{"bytes", &valueNode{nodeType: SizeType, val: "12B"}, 12, false},
+		{"decimal units", &valueNode{nodeType: SizeType, val: "1.5GB"}, 1500000000, false},
+		{"binary units", &valueNode{nodeType: SizeType, val: "512MiB"}, 536870912, false},
+		{"fractional binary units", &valueNode{nodeType: SizeType, val: "1.5KiB"}, 1536, false},
+		{"partial byte", &valueNode{nodeType: SizeType, val: "1.5B"}, 0, true},
+		{"too large", &valueNode{nodeType: SizeType, val: "100000PiB"}, 0, true},
+		{"not a size", &valueNode{nodeType: NumberType, val: "12"}, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			size, err := ByteSize(test.node)
+			assert.Equal(t, test.err, err != nil)
+			assert.Equal(t, test.expected, size)
+		})
+	}
+}
+
+func TestDuration(t *testing.T) {
+	d, err := Duration(&valueNode{nodeType: DurationType, val: "2h30m"})
+	assert.Nil(t, err)
+	assert.Equal(t, 150*time.Minute, d)
+
+	d, err = Duration(&valueNode{nodeType: DurationType, val: "250ms"})
+	assert.Nil(t, err)
+	assert.Equal(t, 250*time.Millisecond, d)
+
+	_, err = Duration(&valueNode{nodeType: NumberType, val: "250"})
+	assert.NotNil(t, err)
+}
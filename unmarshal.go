@@ -0,0 +1,609 @@
+package confl
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decorated is a decorated value decoded by Unmarshal, which keeps the
+// decorator alongside the value
+type Decorated struct {
+
+	// Name is the name of the decorator
+	Name string
+
+	// Value is the decoded value inside the decorator
+	Value interface{}
+}
+
+// Unmarshaler is implemented by types that decode themselves from a node
+type Unmarshaler interface {
+	UnmarshalConfl(Node) error
+}
+
+// UnmarshalOptions configures how Unmarshal decodes a document
+type UnmarshalOptions struct {
+
+	// Parse are the options for parsing the document
+	Parse Options
+
+	// UseNumber decodes numbers as a Number rather than an int64 or float64
+	UseNumber bool
+
+	// Decorated returns the Go value for a decorated value, given the name of
+	// the decorator and the decoded value. By default it's a Decorated.
+	// Returning value alone drops the decorator.
+	Decorated func(name string, value interface{}) interface{}
+}
+
+// Unmarshal parses a document and stores it in v, which must be a non-nil
+// pointer. Decoding into an interface{} gives natural Go types:
+//
+//	maps                 map[string]interface{}
+//	lists                []interface{}
+//	numbers              int64 if it's an integer that fits, or float64
+//	booleans             bool
+//	words and strings    string
+//	dates and times      time.Time
+//	sizes                int64, in bytes
+//	durations            time.Duration
+//	null                 nil
+//
+// Decorated values are decoded as a Decorated, and decorated map keys are
+// written with their decorator, like `device(wifi0)`, so nothing is lost. A
+// map with both a decorated key and a string key written the same way, like
+// `dev(a)` and `"dev(a)"`, is an error rather than one replacing the other.
+//
+// Other types are decoded by the same rules as encoding/json. Maps are
+// decoded into structs by matching keys to the name in a field's `confl` tag,
+// or to the field's name regardless of case, and keys without a field are
+// ignored. Maps with string keys, slices, arrays, and pointers are filled in
+// from maps, lists, and values. Numbers decode into any integer or float type
+// they fit, sizes into integers as a number of bytes, durations into a
+// time.Duration, dates and times into a time.Time, and numbers into a Number
+// as written. A Node field receives the node itself. Decorators are ignored
+// outside of interface{} values, and null sets a value to its zero value.
+//
+// Types that implement Unmarshaler decode themselves from their node, at any
+// depth. Otherwise types that implement encoding.TextUnmarshaler decode
+// themselves from the text of a value, and map keys of such a type from the
+// key.
+//
+// A `confl` tag may follow the name with options, like
+// `confl:"port,default=8080"`:
+//
+//	default=value    the value, in confl syntax, when the key is missing
+//	required         it's an error for the key to be missing
+//	inline           the keys of an embedded struct are the keys of its parent
+//	remain           a map[string]Node, or other map with string keys, that
+//	                 gets every key without a field
+//	decorator        a string that gets the decorator of the map, or if it
+//	                 has none, of its key, like device for device(wifi0)={}
+//	group            a map with string keys that gets every key decorated
+//	                 with the name, by its value, so `confl:"device,group"`
+//	                 gets wifi0 for device(wifi0)={}
+//
+// The documented boolean words decode into a bool whether or not they're
+// parsed as booleans, and into a string as they're spelled. In an interface{}
+// they're a bool only when the Parse options set Bools, and otherwise a
+// string like any other word.
+func Unmarshal(data []byte, v interface{}) error {
+	return UnmarshalWithOptions(data, v, UnmarshalOptions{})
+}
+
+// UnmarshalWithOptions parses a document and stores it in v like Unmarshal,
+// using the given options
+func UnmarshalWithOptions(data []byte, v interface{}, opts UnmarshalOptions) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Cannot unmarshal into %T, it must be a non-nil pointer", v)
+	}
+
+	doc, err := ParseWithOptions(bytes.NewReader(data), opts.Parse)
+	if err != nil {
+		return err
+	}
+
+	d := &decodeState{opts: opts}
+	return d.decode(doc, rv.Elem())
+}
+
+// decodeState is the state of decoding a document into Go values
+type decodeState struct {
+
+	// opts are the options for decoding
+	opts UnmarshalOptions
+
+	// path is the path of the node being decoded, for errors
+	path []mapKey
+
+	// key is the key of the map pair being decoded, or nil at the root
+	key Node
+}
+
+var (
+	nodeType            = reflect.TypeOf((*Node)(nil)).Elem()
+	numberType          = reflect.TypeOf(Number(""))
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// decode decodes n into v
+func (d *decodeState) decode(n Node, v reflect.Value) error {
+	switch {
+	case v.Type() == nodeType:
+		v.Set(reflect.ValueOf(&n).Elem())
+		return nil
+	case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		val, err := decodeValue(n, d.opts)
+		if err != nil {
+			return d.errorf("%s", err)
+		}
+		if val == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(val))
+		}
+		return nil
+	case n.Type() == NullType:
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	case v.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(n, v.Elem())
+	}
+
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(Unmarshaler); ok {
+			return d.wrap(u.UnmarshalConfl(n))
+		}
+	}
+
+	switch v.Type() {
+	case numberType:
+		if n.Type() != NumberType {
+			return d.mismatch(n, v)
+		}
+		v.SetString(n.Value())
+		return nil
+	case durationType:
+		dur, err := Duration(n)
+		if err != nil {
+			return d.mismatch(n, v)
+		}
+		v.SetInt(int64(dur))
+		return nil
+	case timeType:
+		if !IsTime(n) {
+			return d.mismatch(n, v)
+		}
+		t, err := Time(n)
+		if err != nil {
+			return d.errorf("%s", err)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if n.Type() == MapType || n.Type() == ListType {
+				return d.mismatch(n, v)
+			}
+			return d.wrap(u.UnmarshalText([]byte(n.Value())))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := Bool(n)
+		if err != nil {
+			return d.mismatch(n, v)
+		}
+		v.SetBool(b)
+	case reflect.String:
+		if !IsText(n) && n.Type() != BoolType {
+			return d.mismatch(n, v)
+		}
+		v.SetString(n.Value())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return d.decodeInt(n, v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return d.decodeUint(n, v)
+	case reflect.Float32, reflect.Float64:
+		if n.Type() != NumberType {
+			return d.mismatch(n, v)
+		}
+		f, err := Number(n.Value()).Float64()
+		if err != nil || v.OverflowFloat(f) {
+			return d.errorf("Number %s doesn't fit in %s", n.Value(), v.Type())
+		}
+		v.SetFloat(f)
+	case reflect.Slice, reflect.Array:
+		return d.decodeList(n, v)
+	case reflect.Map:
+		return d.decodeMap(n, v)
+	case reflect.Struct:
+		return d.decodeStruct(n, v)
+	default:
+		return d.mismatch(n, v)
+	}
+
+	return nil
+}
+
+// decodeInt decodes a number or size into a signed integer
+func (d *decodeState) decodeInt(n Node, v reflect.Value) error {
+	var i int64
+	var err error
+
+	switch n.Type() {
+	case NumberType:
+		i, err = Number(n.Value()).Int64()
+	case SizeType:
+		size, err := ByteSize(n)
+		if err != nil {
+			return d.errorf("%s", err)
+		}
+		if v.OverflowInt(size) {
+			return d.errorf("Size %s doesn't fit in %s", n.Value(), v.Type())
+		}
+		v.SetInt(size)
+		return nil
+	default:
+		return d.mismatch(n, v)
+	}
+
+	if err != nil || v.OverflowInt(i) {
+		return d.errorf("Number %s doesn't fit in %s", n.Value(), v.Type())
+	}
+	v.SetInt(i)
+	return nil
+}
+
+// decodeUint decodes a number or size into an unsigned integer
+func (d *decodeState) decodeUint(n Node, v reflect.Value) error {
+	var i uint64
+	var err error
+
+	switch n.Type() {
+	case NumberType:
+		var bi *big.Int
+		if bi, err = Number(n.Value()).BigInt(); err == nil && bi.IsUint64() {
+			i = bi.Uint64()
+		} else {
+			err = fmt.Errorf("Number %s is not an unsigned integer", n.Value())
+		}
+	case SizeType:
+		size, err := ByteSize(n)
+		if err != nil {
+			return d.errorf("%s", err)
+		}
+		if v.OverflowUint(uint64(size)) {
+			return d.errorf("Size %s doesn't fit in %s", n.Value(), v.Type())
+		}
+		v.SetUint(uint64(size))
+		return nil
+	default:
+		return d.mismatch(n, v)
+	}
+
+	if err != nil || v.OverflowUint(i) {
+		return d.errorf("Number %s doesn't fit in %s", n.Value(), v.Type())
+	}
+	v.SetUint(i)
+	return nil
+}
+
+// decodeList decodes a list into a slice or array
+func (d *decodeState) decodeList(n Node, v reflect.Value) error {
+	if n.Type() != ListType {
+		return d.mismatch(n, v)
+	}
+
+	children := n.Children()
+	if v.Kind() == reflect.Array {
+		if len(children) > v.Len() {
+			return d.errorf("Cannot unmarshal a list of %d items into %s", len(children), v.Type())
+		}
+		for i := len(children); i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		}
+	} else {
+		v.Set(reflect.MakeSlice(v.Type(), len(children), len(children)))
+	}
+
+	for i, child := range children {
+		d.path = append(d.path, mapKey{value: strconv.Itoa(i)})
+		err := d.decode(child, v.Index(i))
+		d.path = d.path[:len(d.path)-1]
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeMap decodes a map into a Go map with string keys
+func (d *decodeState) decodeMap(n Node, v reflect.Value) error {
+	if n.Type() != MapType {
+		return d.mismatch(n, v)
+	}
+
+	keys, err := mapKeyNames(n)
+	if err != nil {
+		return d.errorf("%s", err)
+	}
+
+	for i, pair := range KVPairs(n) {
+		if err := d.decodeEntry(pair, keys[i], v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeStruct decodes a map into a struct
+func (d *decodeState) decodeStruct(n Node, v reflect.Value) error {
+	if n.Type() != MapType {
+		return d.mismatch(n, v)
+	}
+
+	keys, err := mapKeyNames(n)
+	if err != nil {
+		return d.errorf("%s", err)
+	}
+
+	fields := structFields(v.Type())
+	remain := remainField(fields)
+	decoded := make([]bool, len(fields))
+	for i, pair := range KVPairs(n) {
+		// a decorated key with a group field goes into it by its value
+		if g := groupField(fields, pair.Key.Decorator()); pair.Key.Decorator() != "" && g >= 0 {
+			decoded[g] = true
+			if err := d.decodeEntry(pair, pair.Key.Value(), fieldByIndex(v, fields[g].index)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f := fieldNamed(fields, keys[i])
+		if f < 0 {
+			if remain < 0 {
+				continue
+			}
+			if err := d.decodeEntry(pair, keys[i], fieldByIndex(v, fields[remain].index)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		decoded[f] = true
+		if err := d.decodeChild(pair, fieldByIndex(v, fields[f].index)); err != nil {
+			return err
+		}
+	}
+
+	for i := range fields {
+		f := &fields[i]
+		switch {
+		case decoded[i]:
+		case f.decorator:
+			if err := d.decodeDecorator(n, fieldByIndex(v, f.index)); err != nil {
+				return err
+			}
+		case f.required:
+			return d.errorf("Missing required key %s", f.name)
+		case f.hasDefault:
+			if err := d.decodeDefault(f, fieldByIndex(v, f.index)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// decodeEntry decodes the value of a map pair into a Go map with string keys
+// under key
+func (d *decodeState) decodeEntry(pair KVPair, key string, m reflect.Value) error {
+	if m.Kind() != reflect.Map {
+		return d.errorf("Cannot unmarshal a map into %s", m.Type())
+	}
+
+	keyType := m.Type().Key()
+	var k reflect.Value
+	switch {
+	case reflect.PtrTo(keyType).Implements(textUnmarshalerType):
+		k = reflect.New(keyType)
+		if err := k.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(key)); err != nil {
+			return d.wrap(fmt.Errorf("Illegal key %s: %w", key, err))
+		}
+		k = k.Elem()
+	case keyType.Kind() == reflect.String:
+		k = reflect.ValueOf(key).Convert(keyType)
+	default:
+		return d.errorf("Cannot unmarshal a map into %s, which doesn't have string keys", m.Type())
+	}
+
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+
+	elem := reflect.New(m.Type().Elem()).Elem()
+	if err := d.decodeChild(pair, elem); err != nil {
+		return err
+	}
+	m.SetMapIndex(k, elem)
+
+	return nil
+}
+
+// decodeDecorator sets v to the decorator of a map, or if it doesn't have
+// one, of the key the map is under
+func (d *decodeState) decodeDecorator(n Node, v reflect.Value) error {
+	if v.Kind() != reflect.String {
+		return d.errorf("Cannot unmarshal a decorator into %s", v.Type())
+	}
+
+	decorator := n.Decorator()
+	if decorator == "" && d.key != nil {
+		decorator = d.key.Decorator()
+	}
+	v.SetString(decorator)
+
+	return nil
+}
+
+// decodeDefault decodes the default value of a field that has no key
+func (d *decodeState) decodeDefault(f *field, v reflect.Value) error {
+	n, err := ParseWithOptions(strings.NewReader(f.defaultValue), Options{AnyRoot: true, Bools: d.opts.Parse.Bools})
+	if err != nil {
+		return d.errorf("Illegal default %s for %s: %s", f.defaultValue, f.name, err)
+	}
+
+	d.path = append(d.path, mapKey{value: f.name})
+	err = d.decode(n, v)
+	d.path = d.path[:len(d.path)-1]
+
+	return err
+}
+
+// decodeChild decodes the value of a map pair into v
+func (d *decodeState) decodeChild(pair KVPair, v reflect.Value) error {
+	key := d.key
+	d.key = pair.Key
+	d.path = append(d.path, keyOf(pair.Key))
+
+	err := d.decode(pair.Value, v)
+
+	d.key = key
+	d.path = d.path[:len(d.path)-1]
+
+	return err
+}
+
+// mismatch returns the error for a node that can't be decoded into v
+func (d *decodeState) mismatch(n Node, v reflect.Value) error {
+	return d.errorf("Cannot unmarshal a %s into %s", n.Type(), v.Type())
+}
+
+// wrap returns err noting the path of the node being decoded, so it can still
+// be unwrapped
+func (d *decodeState) wrap(err error) error {
+	if err == nil || len(d.path) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("%w at %s", err, joinPatchPath(d.path))
+}
+
+// errorf returns an error noting the path of the node being decoded
+func (d *decodeState) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if len(d.path) == 0 {
+		return errors.New(msg)
+	}
+
+	return fmt.Errorf("%s at %s", msg, joinPatchPath(d.path))
+}
+
+// mapKeyNames returns the names that the keys of a map decode to, which are
+// the keys as they're written along with any decorator. It's an error for two
+// keys to have the same name, which happens when a string key looks like a
+// decorated key.
+func mapKeyNames(n Node) ([]string, error) {
+	pairs := KVPairs(n)
+	names := make([]string, len(pairs))
+	seen := make(map[string]bool, len(pairs))
+
+	for i, pair := range pairs {
+		names[i] = keyOf(pair.Key).String()
+		if seen[names[i]] {
+			return nil, fmt.Errorf("Map keys %s and %q both unmarshal as %s", names[i], names[i], names[i])
+		}
+		seen[names[i]] = true
+	}
+
+	return names, nil
+}
+
+// decodeValue decodes n into its natural Go type
+func decodeValue(n Node, opts UnmarshalOptions) (interface{}, error) {
+	val, err := decodeUndecorated(n, opts)
+	if err != nil || n.Decorator() == "" || n.Type() == NullType {
+		return val, err
+	}
+
+	if opts.Decorated != nil {
+		return opts.Decorated(n.Decorator(), val), nil
+	}
+	return Decorated{Name: n.Decorator(), Value: val}, nil
+}
+
+// decodeUndecorated decodes n into its natural Go type, ignoring its
+// decorator
+func decodeUndecorated(n Node, opts UnmarshalOptions) (interface{}, error) {
+	switch n.Type() {
+	case MapType:
+		keys, err := mapKeyNames(n)
+		if err != nil {
+			return nil, err
+		}
+
+		m := make(map[string]interface{})
+		for i, pair := range KVPairs(n) {
+			val, err := decodeValue(pair.Value, opts)
+			if err != nil {
+				return nil, err
+			}
+			m[keys[i]] = val
+		}
+		return m, nil
+	case ListType:
+		list := make([]interface{}, 0, len(n.Children()))
+		for _, child := range n.Children() {
+			val, err := decodeValue(child, opts)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, val)
+		}
+		return list, nil
+	case NumberType:
+		num := Number(n.Value())
+		if opts.UseNumber {
+			return num, nil
+		}
+		if i, err := num.Int64(); err == nil {
+			return i, nil
+		}
+		return num.Float64()
+	case BoolType:
+		return Bool(n)
+	case WordType, StringType:
+		return n.Value(), nil
+	case DateType, TimeType, DateTimeType:
+		return Time(n)
+	case SizeType:
+		return ByteSize(n)
+	case DurationType:
+		return Duration(n)
+	case NullType:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Cannot unmarshal a %s", n.Type())
+	}
+}
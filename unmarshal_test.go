@@ -0,0 +1,423 @@
+package confl
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshal(t *testing.T) {
+	src := []byte(`
+		device(wifi0)={
+			network="Pretty fly for a wifi"
+			dhcp=true
+			mtu=1500
+			load=0.75
+			mask=0x10
+			big=123456789012345678901234567890
+			dns=["10.0.0.1" "10.0.0.2"]
+			key=path("/etc/vpn.key")
+			proxy=null()
+			renewed=2019-05-01
+			lease=12h
+			buffer=4KB
+		}
+	`)
+
+	var v interface{}
+	assert.Nil(t, Unmarshal(src, &v))
+	assert.Equal(
+		t,
+		map[string]interface{}{
+			"device(wifi0)": map[string]interface{}{
+				"network": "Pretty fly for a wifi",
+				"dhcp":    "true",
+				"mtu":     int64(1500),
+				"load":    0.75,
+				"mask":    int64(16),
+				"big":     1.2345678901234568e+29,
+				"dns":     []interface{}{"10.0.0.1", "10.0.0.2"},
+				"key":     Decorated{Name: "path", Value: "/etc/vpn.key"},
+				"proxy":   nil,
+				"renewed": time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC),
+				"lease":   12 * time.Hour,
+				"buffer":  int64(4000),
+			},
+		},
+		v,
+	)
+}
+
+func TestUnmarshalWithOptions(t *testing.T) {
+	src := []byte(`a=1.50 b=path("/etc") c=[dec(true)]`)
+
+	var m map[string]interface{}
+	err := UnmarshalWithOptions(src, &m, UnmarshalOptions{
+		Parse:     Options{Bools: true},
+		UseNumber: true,
+		Decorated: func(name string, value interface{}) interface{} {
+			return value
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		map[string]interface{}{
+			"a": Number("1.50"),
+			"b": "/etc",
+			"c": []interface{}{true},
+		},
+		m,
+	)
+}
+
+func TestUnmarshalTargets(t *testing.T) {
+	var list []interface{}
+	opts := UnmarshalOptions{Parse: Options{AnyRoot: true}}
+	assert.Nil(t, UnmarshalWithOptions([]byte(`[1 a]`), &list, opts))
+	assert.Equal(t, []interface{}{int64(1), "a"}, list)
+
+	err := UnmarshalWithOptions([]byte(`[1 a]`), &map[string]interface{}{}, opts)
+	assert.Equal(t, "Cannot unmarshal a list into map[string]interface {}", err.Error())
+
+	err = Unmarshal([]byte(`a=1`), &list)
+	assert.Equal(t, "Cannot unmarshal a map into []interface {}", err.Error())
+
+	var m map[string]interface{}
+	err = Unmarshal([]byte(`a=1`), m)
+	assert.Equal(t, "Cannot unmarshal into map[string]interface {}, it must be a non-nil pointer", err.Error())
+
+	var v interface{}
+	err = Unmarshal([]byte(`a=]`), &v)
+	assert.Equal(t, ErrUnexpectedClose, err.(*ParseError).Code())
+}
+
+func TestUnmarshalBools(t *testing.T) {
+	// boolean words are only booleans in an interface{} with the Bools option
+	var a, b map[string]interface{}
+	assert.Nil(t, Unmarshal([]byte(`dhcp=yes`), &a))
+	assert.Nil(t, UnmarshalWithOptions([]byte(`dhcp=yes`), &b, UnmarshalOptions{Parse: Options{Bools: true}}))
+	assert.Equal(t, map[string]interface{}{"dhcp": "yes"}, a)
+	assert.Equal(t, map[string]interface{}{"dhcp": true}, b)
+
+	// a bool field gets a boolean either way
+	var d struct{ Dhcp bool }
+	assert.Nil(t, Unmarshal([]byte(`dhcp=yes`), &d))
+	assert.True(t, d.Dhcp)
+
+	// a string field keeps the word either way
+	for _, opts := range []Options{{}, {Bools: true}} {
+		var c struct{ Country string }
+		assert.Nil(t, UnmarshalWithOptions([]byte(`country=no`), &c, UnmarshalOptions{Parse: opts}))
+		assert.Equal(t, "no", c.Country)
+	}
+
+	var v interface{}
+	assert.Nil(t, Unmarshal([]byte(`country=no`), &v))
+	assert.Equal(t, map[string]interface{}{"country": "no"}, v)
+}
+
+func TestUnmarshalKeyCollision(t *testing.T) {
+	var v interface{}
+	err := Unmarshal([]byte(`dev(a)=1 "dev(a)"=2`), &v)
+	assert.Equal(t, `Map keys dev(a) and "dev(a)" both unmarshal as dev(a)`, err.Error())
+
+	err = Unmarshal([]byte(`b={dev(a)=1 "dev(a)"=2}`), &map[string]map[string]int{})
+	assert.Equal(t, `Map keys dev(a) and "dev(a)" both unmarshal as dev(a) at /b`, err.Error())
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+	type VPN struct {
+		Host string
+		User string `confl:"username"`
+	}
+
+	type Device struct {
+		Network  string
+		DHCP     bool
+		MTU      uint16
+		Load     float32
+		Retries  *int
+		DNS      []string
+		Gateways [3]string
+		Lease    time.Duration
+		Buffer   int
+		Renewed  time.Time
+		Big      Number
+		Key      string
+		Proxy    *VPN
+		VPN      VPN
+		Extra    map[string]interface{}
+		Raw      Node
+		Ignored  string `confl:"-"`
+		internal string
+	}
+
+	var cfg struct {
+		Devices map[string]Device `confl:"devices"`
+	}
+
+	src := []byte(`
+		devices={
+			wifi0={
+				network="Pretty fly for a wifi"
+				dhcp=true
+				mtu=1500
+				load=0.75
+				retries=3
+				dns=["10.0.0.1" "10.0.0.2"]
+				gateways=["10.0.0.1"]
+				lease=12h
+				buffer=4KiB
+				renewed=2019-05-01
+				big=123456789012345678901234567890
+				key=path("/etc/vpn.key")
+				proxy=null()
+				vpn={host="12.12.12.12" username=frank pass=secret}
+				extra={a=[1 b]}
+				raw=dec({a=1})
+				ignored=x
+				internal=x
+				unknown=x
+			}
+		}
+	`)
+	assert.Nil(t, Unmarshal(src, &cfg))
+
+	dev := cfg.Devices["wifi0"]
+	retries := 3
+	raw := dev.Raw
+	assert.Equal(t, "dec", raw.Decorator())
+	dev.Raw = nil
+	assert.Equal(
+		t,
+		Device{
+			Network:  "Pretty fly for a wifi",
+			DHCP:     true,
+			MTU:      1500,
+			Load:     0.75,
+			Retries:  &retries,
+			DNS:      []string{"10.0.0.1", "10.0.0.2"},
+			Gateways: [3]string{"10.0.0.1"},
+			Lease:    12 * time.Hour,
+			Buffer:   4096,
+			Renewed:  time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC),
+			Big:      Number("123456789012345678901234567890"),
+			Key:      "/etc/vpn.key",
+			VPN:      VPN{Host: "12.12.12.12", User: "frank"},
+			Extra:    map[string]interface{}{"a": []interface{}{int64(1), "b"}},
+		},
+		dev,
+	)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		v   interface{}
+		err string
+	}{
+		{`a=x`, &struct{ A int }{}, "Cannot unmarshal a word into int at /a"},
+		{`a={b=[1 x]}`, &struct{ A struct{ B []int } }{}, "Cannot unmarshal a word into int at /a/b/1"},
+		{`a=300`, &struct{ A uint8 }{}, "Number 300 doesn't fit in uint8 at /a"},
+		{`a=1.5`, &struct{ A int }{}, "Number 1.5 doesn't fit in int at /a"},
+		{`a=1MB`, &struct{ A int16 }{}, "Size 1MB doesn't fit in int16 at /a"},
+		{`a=1KiB`, &struct{ A uint8 }{}, "Size 1KiB doesn't fit in uint8 at /a"},
+		{`a=10000PB`, &struct{ A int64 }{}, "Size 10000PB is too large at /a"},
+		{`a=1.5B`, &struct{ A uint }{}, "Size 1.5B is not a whole number of bytes at /a"},
+		{`a=[1 2 3]`, &struct{ A [2]int }{}, "Cannot unmarshal a list of 3 items into [2]int at /a"},
+		{`a=1`, &struct{ A time.Duration }{}, "Cannot unmarshal a number into time.Duration at /a"},
+		{`a={b=1}`, &map[int]int{}, "Cannot unmarshal a map into map[int]int, which doesn't have string keys"},
+		{`a=1`, &struct{ A chan int }{}, "Cannot unmarshal a number into chan int at /a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			err := Unmarshal([]byte(test.src), test.v)
+			assert.Equal(t, test.err, err.Error())
+		})
+	}
+}
+
+func TestUnmarshalTagOptions(t *testing.T) {
+	type Common struct {
+		Timeout time.Duration `confl:"timeout,default=30s"`
+	}
+
+	type Device struct {
+		Kind    string   `confl:",decorator"`
+		Host    string   `confl:"host,required"`
+		Port    int      `confl:"port,default=8080"`
+		Tags    []string `confl:"tags,default=[a b]"`
+		Common  `confl:",inline"`
+		*Extra  `confl:",inline"`
+		Unknown map[string]Node `confl:",remain"`
+	}
+
+	var cfg map[string]Device
+	err := Unmarshal([]byte(`
+		device(wifi0)={host=router port=80 retries=3 mtu=1500}
+		vpn=tunnel({host=vpn timeout=5s})
+	`), &cfg)
+	assert.Nil(t, err)
+
+	wifi := cfg["device(wifi0)"]
+	assert.Equal(t, "device", wifi.Kind)
+	assert.Equal(t, "router", wifi.Host)
+	assert.Equal(t, 80, wifi.Port)
+	assert.Equal(t, []string{"a", "b"}, wifi.Tags)
+	assert.Equal(t, 30*time.Second, wifi.Timeout)
+	assert.Equal(t, 3, wifi.Retries)
+	assert.Equal(t, []string{"mtu"}, keysOf(wifi.Unknown))
+	assert.Equal(t, "1500", wifi.Unknown["mtu"].Value())
+
+	vpn := cfg["vpn"]
+	assert.Equal(t, "tunnel", vpn.Kind)
+	assert.Equal(t, 8080, vpn.Port)
+	assert.Equal(t, 5*time.Second, vpn.Timeout)
+	assert.Nil(t, vpn.Unknown)
+
+	err = Unmarshal([]byte(`device={port=80}`), &cfg)
+	assert.Equal(t, "Missing required key host at /device", err.Error())
+
+	var bad struct {
+		Port int `confl:"port,default=]"`
+	}
+	err = Unmarshal([]byte(``), &bad)
+	assert.Contains(t, err.Error(), "Illegal default ] for port")
+}
+
+// Extra is an inline struct for TestUnmarshalTagOptions
+type Extra struct {
+	Retries int
+}
+
+// keysOf returns the keys of a map of nodes
+func keysOf(m map[string]Node) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func TestUnmarshalUnmarshalers(t *testing.T) {
+	var cfg struct {
+		Levels    []Level
+		ByLevel   map[Level]int
+		Endpoints map[string]*Endpoint
+	}
+
+	err := Unmarshal([]byte(`
+		levels=[low high]
+		bylevel={low=1 high=2}
+		endpoints={web=tcp("web:80") dns=udp("ns:53")}
+	`), &cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, []Level{1, 2}, cfg.Levels)
+	assert.Equal(t, map[Level]int{1: 1, 2: 2}, cfg.ByLevel)
+	assert.Equal(t, &Endpoint{"tcp", "web:80"}, cfg.Endpoints["web"])
+	assert.Equal(t, &Endpoint{"udp", "ns:53"}, cfg.Endpoints["dns"])
+
+	err = Unmarshal([]byte(`levels=[low medium]`), &cfg)
+	assert.Equal(t, "Unknown level medium at /levels/1", err.Error())
+
+	err = Unmarshal([]byte(`endpoints={web="web:80"}`), &cfg)
+	assert.Equal(t, "Endpoint must be decorated at /endpoints/web", err.Error())
+}
+
+// Level is a TextUnmarshaler and TextMarshaler for tests
+type Level int
+
+// UnmarshalText decodes a level from its name
+func (l *Level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return fmt.Errorf("Unknown level %s", text)
+	}
+
+	return nil
+}
+
+// MarshalText encodes a level as its name
+func (l Level) MarshalText() ([]byte, error) {
+	if l == 2 {
+		return []byte("high"), nil
+	}
+
+	return []byte("low"), nil
+}
+
+// Endpoint is an Unmarshaler and Marshaler for tests, written as an address
+// decorated with its protocol
+type Endpoint struct {
+	Protocol string
+	Address  string
+}
+
+// UnmarshalConfl decodes an endpoint from a decorated value
+func (e *Endpoint) UnmarshalConfl(n Node) error {
+	if n.Decorator() == "" {
+		return errors.New("Endpoint must be decorated")
+	}
+	e.Protocol, e.Address = n.Decorator(), n.Value()
+
+	return nil
+}
+
+// MarshalConfl encodes an endpoint as a decorated value
+func (e Endpoint) MarshalConfl() (Node, error) {
+	return Decorate(NewValue(StringType, e.Address), e.Protocol), nil
+}
+
+func TestUnmarshalGroup(t *testing.T) {
+	type Device struct {
+		Kind    string `confl:",decorator"`
+		Network string
+	}
+
+	type Config struct {
+		Devices map[string]Device `confl:"device,group"`
+		VPNs    map[string]string `confl:"vpn,group"`
+		Host    string
+	}
+
+	src := []byte(`
+		device(wifi0)={network=home}
+		device(wifi1)={network=work}
+		vpn(wifi0)=tunnel
+		host=mail
+	`)
+
+	var cfg Config
+	assert.Nil(t, Unmarshal(src, &cfg))
+	assert.Equal(
+		t,
+		Config{
+			Devices: map[string]Device{
+				"wifi0": {Kind: "device", Network: "home"},
+				"wifi1": {Kind: "device", Network: "work"},
+			},
+			VPNs: map[string]string{"wifi0": "tunnel"},
+			Host: "mail",
+		},
+		cfg,
+	)
+
+	// keys with the same value and different decorators are different keys
+	data, err := Marshal(cfg)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		"device(wifi0)={Network=\"home\"}\ndevice(wifi1)={Network=\"work\"}\nvpn(wifi0)=\"tunnel\"\nHost=\"mail\"\n",
+		string(data),
+	)
+}
@@ -0,0 +1,234 @@
+package watch
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nalanj/confl"
+)
+
+// Config holds the current version of a document for goroutines to read
+// while it's replaced by new versions, usually from a Watcher:
+//
+//	cfg := watch.NewConfig(nil)
+//	w, err := watch.Watch(path, func(doc confl.Node, err error) {
+//		if err == nil {
+//			cfg.Set(doc)
+//		}
+//	})
+//
+// Each new document replaces the old one at once, so readers see either the
+// old document or the new one and never a mix of the two. Values are read by
+// path, in the same form as the paths of a patch, such as
+// `/device(wifi0)/network`.
+type Config struct {
+
+	// doc holds the current snapshot
+	doc atomic.Value
+
+	// setMu serializes Set, so subscribers see changes in order
+	setMu sync.Mutex
+
+	// subMu guards subs
+	subMu sync.Mutex
+
+	// subs are the subscriptions to changes
+	subs []*subscription
+}
+
+// snapshot is a version of the document held by a Config
+type snapshot struct {
+	doc confl.Node
+}
+
+// subscription is a function to call when the value at a path changes
+type subscription struct {
+	path string
+	fn   func(confl.Node)
+}
+
+// NewConfig returns a Config holding doc, which may be nil until the first
+// document is loaded
+func NewConfig(doc confl.Node) *Config {
+	c := &Config{}
+	c.doc.Store(snapshot{doc})
+
+	return c
+}
+
+// Node returns the current document
+func (c *Config) Node() confl.Node {
+	return c.doc.Load().(snapshot).doc
+}
+
+// Set replaces the current document with doc, then calls the subscribers to
+// each path whose value changed. Subscribers must not call Set.
+func (c *Config) Set(doc confl.Node) {
+	c.setMu.Lock()
+	defer c.setMu.Unlock()
+
+	old := c.Node()
+	c.doc.Store(snapshot{doc})
+
+	changes := Diff(old, doc)
+	if len(changes) == 0 {
+		return
+	}
+
+	c.subMu.Lock()
+	subs := append([]*subscription{}, c.subs...)
+	c.subMu.Unlock()
+
+	for _, sub := range subs {
+		for _, change := range changes {
+			if pathsOverlap(sub.path, change.Path) {
+				val, _ := lookup(doc, sub.path)
+				sub.fn(val)
+				break
+			}
+		}
+	}
+}
+
+// Subscribe calls fn with the new value at path each time Set changes it,
+// including when a value inside it changes, or with nil when it's removed.
+// It returns a function that cancels the subscription.
+func (c *Config) Subscribe(path string, fn func(confl.Node)) (cancel func()) {
+	sub := &subscription{path: path, fn: fn}
+
+	c.subMu.Lock()
+	c.subs = append(c.subs, sub)
+	c.subMu.Unlock()
+
+	return func() {
+		c.subMu.Lock()
+		defer c.subMu.Unlock()
+
+		for i, s := range c.subs {
+			if s == sub {
+				c.subs = append(c.subs[:i], c.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Get returns the node at path in the current document
+func (c *Config) Get(path string) (confl.Node, error) {
+	return lookup(c.Node(), path)
+}
+
+// GetString returns the word or string at path
+func (c *Config) GetString(path string) (string, error) {
+	n, err := c.Get(path)
+	if err != nil {
+		return "", err
+	}
+	if !confl.IsText(n) {
+		return "", fmt.Errorf("Value at %s is a %s, not a string", path, n.Type())
+	}
+
+	return n.Value(), nil
+}
+
+// GetBool returns the boolean at path
+func (c *Config) GetBool(path string) (bool, error) {
+	n, err := c.Get(path)
+	if err != nil {
+		return false, err
+	}
+
+	return confl.Bool(n)
+}
+
+// GetInt returns the number at path as an int64
+func (c *Config) GetInt(path string) (int64, error) {
+	n, err := c.Get(path)
+	if err != nil {
+		return 0, err
+	}
+
+	num, err := confl.NodeNumber(n)
+	if err != nil {
+		return 0, err
+	}
+
+	return num.Int64()
+}
+
+// GetFloat returns the number at path as a float64
+func (c *Config) GetFloat(path string) (float64, error) {
+	n, err := c.Get(path)
+	if err != nil {
+		return 0, err
+	}
+
+	num, err := confl.NodeNumber(n)
+	if err != nil {
+		return 0, err
+	}
+
+	return num.Float64()
+}
+
+// GetDuration returns the duration at path
+func (c *Config) GetDuration(path string) (time.Duration, error) {
+	n, err := c.Get(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return confl.Duration(n)
+}
+
+// GetByteSize returns the byte size at path as a number of bytes
+func (c *Config) GetByteSize(path string) (int64, error) {
+	n, err := c.Get(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return confl.ByteSize(n)
+}
+
+// GetTime returns the date, time, or date and time at path
+func (c *Config) GetTime(path string) (time.Time, error) {
+	n, err := c.Get(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return confl.Time(n)
+}
+
+// lookup returns the node at path in doc
+func lookup(doc confl.Node, path string) (confl.Node, error) {
+	if doc == nil {
+		return nil, fmt.Errorf("No document is loaded")
+	}
+	if path == "" {
+		return doc, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("Path %s must begin with /", path)
+	}
+
+	n := doc
+	for _, seg := range strings.Split(path[1:], "/") {
+		n = confl.PathChild(n, seg)
+		if n == nil {
+			return nil, fmt.Errorf("No value at %s", path)
+		}
+	}
+
+	return n, nil
+}
+
+// pathsOverlap returns whether a change at one path changes the value at the
+// other, because they're the same or one is inside the other
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
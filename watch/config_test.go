@@ -0,0 +1,167 @@
+package watch
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nalanj/confl"
+	"github.com/stretchr/testify/assert"
+)
+
+// parse parses src, failing the test if it doesn't parse
+func parse(t *testing.T, src string) confl.Node {
+	t.Helper()
+
+	doc, err := confl.Parse(strings.NewReader(src))
+	assert.Nil(t, err)
+
+	return doc
+}
+
+func TestConfigGet(t *testing.T) {
+	cfg := NewConfig(parse(t, `
+		device={
+			network="Pretty fly for a wifi"
+			dhcp=true
+			mtu=1500
+			load=0.75
+			timeout=30s
+			buffer=4KB
+			renewed=2019-05-01
+			dns=["10.0.0.1" "10.0.0.2"]
+		}
+		"a/b"=escaped
+		host(wifi0)={a=host}
+		wifi0={a=plain}
+	`))
+
+	network, err := cfg.GetString("/device/network")
+	assert.Nil(t, err)
+	assert.Equal(t, "Pretty fly for a wifi", network)
+
+	dhcp, err := cfg.GetBool("/device/dhcp")
+	assert.Nil(t, err)
+	assert.True(t, dhcp)
+
+	mtu, err := cfg.GetInt("/device/mtu")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1500), mtu)
+
+	load, err := cfg.GetFloat("/device/load")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.75, load)
+
+	timeout, err := cfg.GetDuration("/device/timeout")
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Second, timeout)
+
+	buffer, err := cfg.GetByteSize("/device/buffer")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4000), buffer)
+
+	renewed, err := cfg.GetTime("/device/renewed")
+	assert.Nil(t, err)
+	assert.Equal(t, 2019, renewed.Year())
+
+	dns, err := cfg.GetString("/device/dns/1")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2", dns)
+
+	escaped, err := cfg.GetString("/a~1b")
+	assert.Nil(t, err)
+	assert.Equal(t, "escaped", escaped)
+
+	// decorated keys are only matched with their decorator
+	decorated, err := cfg.GetString("/host(wifi0)/a")
+	assert.Nil(t, err)
+	assert.Equal(t, "host", decorated)
+
+	plain, err := cfg.GetString("/wifi0/a")
+	assert.Nil(t, err)
+	assert.Equal(t, "plain", plain)
+
+	_, err = cfg.GetString("/device/missing")
+	assert.Equal(t, "No value at /device/missing", err.Error())
+
+	_, err = cfg.GetString("/device/dns/2")
+	assert.Equal(t, "No value at /device/dns/2", err.Error())
+
+	_, err = cfg.GetString("/device/mtu")
+	assert.Equal(t, "Value at /device/mtu is a number, not a string", err.Error())
+
+	_, err = cfg.GetString("device")
+	assert.Equal(t, "Path device must begin with /", err.Error())
+
+	_, err = NewConfig(nil).Get("/device")
+	assert.Equal(t, "No document is loaded", err.Error())
+}
+
+func TestConfigSubscribe(t *testing.T) {
+	cfg := NewConfig(parse(t, "device={network=home dns=[a b]} port=80"))
+
+	got := map[string][]string{}
+	subscribe := func(path string) func() {
+		return cfg.Subscribe(path, func(n confl.Node) {
+			val := "<nil>"
+			if n != nil {
+				val = n.Type().String()
+				if n.Type() != confl.MapType && n.Type() != confl.ListType {
+					val = n.Value()
+				}
+			}
+			got[path] = append(got[path], val)
+		})
+	}
+
+	subscribe("/device/network")
+	subscribe("/device")
+	subscribe("/device/dns/1")
+	cancel := subscribe("/port")
+
+	cfg.Set(parse(t, "device={network=work dns=[a b]} port=80"))
+	cfg.Set(parse(t, "device={network=work dns=[a c]} port=80"))
+	cfg.Set(parse(t, "device=off port=80"))
+
+	cancel()
+	cfg.Set(parse(t, "device=off port=8080"))
+
+	assert.Equal(
+		t,
+		map[string][]string{
+			"/device/network": {"work", "<nil>"},
+			"/device":         {"map", "map", "off"},
+			"/device/dns/1":   {"c", "<nil>"},
+		},
+		got,
+	)
+}
+
+func TestConfigConcurrent(t *testing.T) {
+	docs := []confl.Node{
+		parse(t, "a=1 b=1"),
+		parse(t, "a=2 b=2"),
+	}
+	cfg := NewConfig(docs[0])
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				doc := cfg.Node()
+				a, _ := lookup(doc, "/a")
+				b, _ := lookup(doc, "/b")
+				assert.Equal(t, a.Value(), b.Value())
+			}
+		}()
+	}
+
+	for j := 0; j < 1000; j++ {
+		cfg.Set(docs[j%2])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,138 @@
+package watch
+
+import (
+	"strconv"
+
+	"github.com/nalanj/confl"
+)
+
+// ChangeType is the kind of a Change
+type ChangeType int
+
+const (
+	// Added is a map key or list item that's new
+	Added ChangeType = iota
+
+	// Removed is a map key or list item that's gone
+	Removed
+
+	// Modified is a value that's been replaced, or a map or list whose type
+	// or decorator changed
+	Modified
+)
+
+// String returns the name of the change type
+func (t ChangeType) String() string {
+	switch t {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Change is a single difference between two documents
+type Change struct {
+
+	// Type is the kind of change
+	Type ChangeType
+
+	// Path is the path of the node that changed, in the same form as the
+	// paths of a patch, such as `/device(wifi0)/dns/0`. The empty path is the
+	// document itself. Map keys are matched by both decorator and value, and
+	// are written in the path with their decorator, as by
+	// confl.PathSegment.
+	Path string
+
+	// Old is the node before the change, or nil if it was added
+	Old confl.Node
+
+	// New is the node after the change, or nil if it was removed
+	New confl.Node
+}
+
+// Diff returns the changes from old to new. Maps are compared key by key
+// regardless of order, and lists item by item, so only the parts that changed
+// are reported. Either document may be nil.
+func Diff(old, new confl.Node) []Change {
+	return diffNodes(nil, "", old, new)
+}
+
+// diffNodes appends the changes from old to new at path to changes
+func diffNodes(changes []Change, path string, old, new confl.Node) []Change {
+	switch {
+	case old == nil && new == nil:
+		return changes
+	case old == nil:
+		return append(changes, Change{Type: Added, Path: path, New: new})
+	case new == nil:
+		return append(changes, Change{Type: Removed, Path: path, Old: old})
+	case old.Type() != new.Type() || old.Decorator() != new.Decorator():
+		return append(changes, Change{Type: Modified, Path: path, Old: old, New: new})
+	}
+
+	switch old.Type() {
+	case confl.MapType:
+		return diffMaps(changes, path, old, new)
+	case confl.ListType:
+		return diffLists(changes, path, old, new)
+	}
+
+	if old.Value() != new.Value() {
+		changes = append(changes, Change{Type: Modified, Path: path, Old: old, New: new})
+	}
+	return changes
+}
+
+// diffMaps appends the changes between two maps to changes. Keys are matched
+// by their path segments, which include their decorators.
+func diffMaps(changes []Change, path string, old, new confl.Node) []Change {
+	newValues := make(map[string]confl.Node)
+	for _, pair := range confl.KVPairs(new) {
+		newValues[confl.PathSegment(pair.Key)] = pair.Value
+	}
+
+	oldValues := make(map[string]confl.Node)
+	for _, pair := range confl.KVPairs(old) {
+		seg := confl.PathSegment(pair.Key)
+		oldValues[seg] = pair.Value
+		changes = diffNodes(changes, joinPath(path, seg), pair.Value, newValues[seg])
+	}
+
+	for _, pair := range confl.KVPairs(new) {
+		seg := confl.PathSegment(pair.Key)
+		if _, ok := oldValues[seg]; !ok {
+			changes = append(changes, Change{Type: Added, Path: joinPath(path, seg), New: pair.Value})
+		}
+	}
+
+	return changes
+}
+
+// diffLists appends the changes between two lists to changes
+func diffLists(changes []Change, path string, old, new confl.Node) []Change {
+	oldItems, newItems := old.Children(), new.Children()
+
+	for i := 0; i < len(oldItems) || i < len(newItems); i++ {
+		var oldItem, newItem confl.Node
+		if i < len(oldItems) {
+			oldItem = oldItems[i]
+		}
+		if i < len(newItems) {
+			newItem = newItems[i]
+		}
+
+		changes = diffNodes(changes, joinPath(path, strconv.Itoa(i)), oldItem, newItem)
+	}
+
+	return changes
+}
+
+// joinPath appends a path segment to a path
+func joinPath(path string, seg string) string {
+	return path + "/" + seg
+}
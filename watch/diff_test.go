@@ -0,0 +1,107 @@
+package watch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nalanj/confl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		changes []string
+	}{
+		{
+			"unchanged",
+			"a=1 b={c=[x y]}",
+			"b={c=[x y]} a=1",
+			[]string{},
+		},
+		{
+			"modified value",
+			"a=1 b={c=2}",
+			"a=1 b={c=3}",
+			[]string{"modified /b/c 2 3"},
+		},
+		{
+			"added and removed keys",
+			"a=1 b=2",
+			"b=2 c=3",
+			[]string{"removed /a 1 ", "added /c  3"},
+		},
+		{
+			"list items",
+			"dns=[a b c]",
+			"dns=[a d]",
+			[]string{"modified /dns/1 b d", "removed /dns/2 c "},
+		},
+		{
+			"decorator",
+			"a=1 b=path(x)",
+			"a=1 b=x",
+			[]string{"modified /b x x"},
+		},
+		{
+			"type",
+			"a=[1]",
+			"a={b=1}",
+			[]string{"modified /a  "},
+		},
+		{
+			"decorated keys",
+			"device(a)=1 host(a)=2",
+			"device(a)=1 host(a)=3 a=4",
+			[]string{"modified /host(a) 2 3", "added /a  4"},
+		},
+		{
+			"escaped key",
+			`"a/b~c"=1`,
+			`"a/b~c"=2`,
+			[]string{"modified /a~1b~0c 1 2"},
+		},
+		{
+			"escaped decorated key",
+			`dev("a(b)")=1`,
+			`dev("a(b)")=2`,
+			[]string{"modified /dev(a~2b~3) 1 2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old, err := confl.Parse(strings.NewReader(test.old))
+			assert.Nil(t, err)
+			new, err := confl.Parse(strings.NewReader(test.new))
+			assert.Nil(t, err)
+
+			changes := []string{}
+			for _, change := range Diff(old, new) {
+				changes = append(changes, change.Type.String()+" "+change.Path+" "+
+					value(change.Old)+" "+value(change.New))
+			}
+			assert.Equal(t, test.changes, changes)
+		})
+	}
+}
+
+func TestDiffNil(t *testing.T) {
+	doc, err := confl.Parse(strings.NewReader("a=1"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []Change{{Type: Added, Path: "", New: doc}}, Diff(nil, doc))
+	assert.Equal(t, []Change{{Type: Removed, Path: "", Old: doc}}, Diff(doc, nil))
+	assert.Nil(t, Diff(nil, nil))
+}
+
+// value returns the value of n, or an empty string if it's nil
+func value(n confl.Node) string {
+	if n == nil {
+		return ""
+	}
+
+	return n.Value()
+}
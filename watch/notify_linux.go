@@ -0,0 +1,92 @@
+//go:build linux
+// +build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// inotifyMask are the inotify events on the file's directory that may
+// change the file. Editors often save by writing a new file and renaming it
+// over the old one, so the directory is watched rather than the file.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM
+
+// inotifier notices changes to a file with inotify
+type inotifier struct {
+
+	// name is the name of the file within its directory
+	name string
+
+	// f reads events from inotify
+	f *os.File
+
+	// c receives a value each time the file changes
+	c chan struct{}
+}
+
+// newNotifier returns a notifier for changes to path, which uses inotify,
+// or polls every interval if inotify isn't available
+func newNotifier(path string, interval time.Duration) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return newPoller(path, interval), nil
+	}
+
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), inotifyMask); err != nil {
+		syscall.Close(fd)
+		return nil, &os.PathError{Op: "watch", Path: filepath.Dir(path), Err: err}
+	}
+
+	n := &inotifier{
+		name: filepath.Base(path),
+		f:    os.NewFile(uintptr(fd), "inotify"),
+		c:    make(chan struct{}, 1),
+	}
+	go n.run()
+
+	return n, nil
+}
+
+// run reads events until the notifier is closed
+func (n *inotifier) run() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		size, err := n.f.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= size; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			offset = start + int(event.Len)
+
+			name := string(buf[start:offset])
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+
+			if name == n.name || event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				notify(n.c)
+			}
+		}
+	}
+}
+
+// changes returns the channel that receives a value each time the file
+// changes
+func (n *inotifier) changes() <-chan struct{} {
+	return n.c
+}
+
+// close stops watching for events
+func (n *inotifier) close() error {
+	return n.f.Close()
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+import "time"
+
+// newNotifier returns a notifier for changes to path, which polls every
+// interval
+func newNotifier(path string, interval time.Duration) (notifier, error) {
+	return newPoller(path, interval), nil
+}
@@ -0,0 +1,81 @@
+package watch
+
+import (
+	"os"
+	"time"
+)
+
+// poller notices changes to a file by checking its size and modification
+// time at an interval
+type poller struct {
+
+	// path is the path of the file being polled
+	path string
+
+	// c receives a value each time the file changes
+	c chan struct{}
+
+	// done is closed when the poller is closed
+	done chan struct{}
+}
+
+// newPoller returns a notifier that polls path every interval
+func newPoller(path string, interval time.Duration) *poller {
+	p := &poller{path: path, c: make(chan struct{}, 1), done: make(chan struct{})}
+
+	last, lastErr := os.Stat(path)
+	go p.run(interval, last, lastErr)
+
+	return p
+}
+
+// run polls the file until the poller is closed, starting from the given
+// stat of it
+func (p *poller) run(interval time.Duration, last os.FileInfo, lastErr error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(p.path)
+		if !sameFile(last, lastErr, info, err) {
+			notify(p.c)
+		}
+		last, lastErr = info, err
+	}
+}
+
+// changes returns the channel that receives a value each time the file
+// changes
+func (p *poller) changes() <-chan struct{} {
+	return p.c
+}
+
+// close stops polling
+func (p *poller) close() error {
+	close(p.done)
+	return nil
+}
+
+// sameFile returns whether two stats of a file look the same
+func sameFile(a os.FileInfo, aErr error, b os.FileInfo, bErr error) bool {
+	if aErr != nil || bErr != nil {
+		return aErr != nil && bErr != nil
+	}
+
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// notify sends on c without blocking, since a change that's already pending
+// covers any that follow it
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
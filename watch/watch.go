@@ -0,0 +1,299 @@
+/*
+Package watch reloads a confl document whenever its file changes, for daemons
+that pick up configuration changes without restarting.
+
+	w, err := watch.Watch("/etc/app.confl", func(doc confl.Node, err error) {
+		if err != nil {
+			log.Printf("config not reloaded: %s", err)
+			return
+		}
+		apply(doc)
+	})
+
+Changes are noticed with inotify on Linux, and by polling the file elsewhere.
+Only documents that parse are delivered, so after an error the last good
+document stays in use.
+
+A Config holds the latest document for the rest of a program to read typed
+values from, and to subscribe to changes in them.
+*/
+package watch
+
+import (
+	"bytes"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nalanj/confl"
+)
+
+const (
+	// defaultInterval is how often the file is polled if there's no interval
+	// in the options
+	defaultInterval = time.Second
+
+	// defaultDebounce is how long the file must be left alone before it's
+	// reloaded if there's no debounce in the options
+	defaultDebounce = 100 * time.Millisecond
+)
+
+// Options configures a Watcher
+type Options struct {
+
+	// Interval is how often the file is checked for changes when it has to be
+	// polled. Defaults to a second.
+	Interval time.Duration
+
+	// Debounce is how long the file must go without changes before it's
+	// reloaded, so a burst of writes is only loaded once. Defaults to 100ms.
+	Debounce time.Duration
+
+	// Parse are the options for parsing the document. The Filename defaults
+	// to the path being watched.
+	Parse confl.Options
+
+	// Poll forces polling even where inotify is available, such as for files
+	// on network filesystems that inotify doesn't see changes to
+	Poll bool
+
+	// Changed is called, if it's set, with the changes from the last good
+	// document just before each new one is delivered
+	Changed func(changes []Change)
+}
+
+// Watcher watches a file and delivers its document each time it changes
+type Watcher struct {
+
+	// path is the path of the file being watched
+	path string
+
+	// opts are the options for the watcher
+	opts Options
+
+	// fn receives each new document, or the error from loading one
+	fn func(confl.Node, error)
+
+	// notifier reports possible changes to the file
+	notifier notifier
+
+	// mu guards doc, src, closed, delivering, and deliverer
+	mu sync.Mutex
+
+	// doc is the last document that was delivered
+	doc confl.Node
+
+	// src is the source of doc
+	src []byte
+
+	// closed notes that the watcher has been closed, so nothing more is
+	// delivered
+	closed bool
+
+	// delivering notes that fn or the Changed option is being called
+	delivering bool
+
+	// deliverer is the ID of the goroutine calling fn while delivering, so
+	// Close can tell when it's called from fn
+	deliverer uint64
+
+	// closeOnce closes done and the notifier the first time Close is called
+	closeOnce sync.Once
+
+	// closeErr is the error from closing the notifier
+	closeErr error
+
+	// done is closed when the watcher is closed
+	done chan struct{}
+
+	// stopped is closed once the watcher has stopped delivering documents
+	stopped chan struct{}
+}
+
+// notifier sends on its channel when the file it's watching may have changed
+type notifier interface {
+	changes() <-chan struct{}
+	close() error
+}
+
+// Watch loads the document at path, calling fn with it, and then calls fn
+// again each time the file changes. Errors reading or parsing the file are
+// also passed to fn, with a nil document. fn is never called concurrently.
+func Watch(path string, fn func(confl.Node, error)) (*Watcher, error) {
+	return WatchWithOptions(path, Options{}, fn)
+}
+
+// WatchWithOptions watches the document at path like Watch, using the given
+// options
+func WatchWithOptions(path string, opts Options, fn func(confl.Node, error)) (*Watcher, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = defaultDebounce
+	}
+	if opts.Parse.Filename == "" {
+		opts.Parse.Filename = path
+	}
+
+	var n notifier
+	var err error
+	if opts.Poll {
+		n = newPoller(path, opts.Interval)
+	} else {
+		n, err = newNotifier(path, opts.Interval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w := &Watcher{
+		path:     path,
+		opts:     opts,
+		fn:       fn,
+		notifier: n,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	w.reload()
+	go w.run()
+
+	return w, nil
+}
+
+// Node returns the last good document, or nil if there hasn't been one
+func (w *Watcher) Node() confl.Node {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.doc
+}
+
+// Close stops watching the file. Once it returns fn won't be called again.
+// Close may be called more than once, from any goroutine, and from within fn
+// itself. If fn is running when Close is called from another goroutine, Close
+// waits for it to return.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		w.mu.Lock()
+		w.closed = true
+		w.mu.Unlock()
+
+		close(w.done)
+		w.closeErr = w.notifier.close()
+	})
+
+	// waiting for fn to return would deadlock when it's fn closing the
+	// watcher
+	w.mu.Lock()
+	fromFn := w.delivering && w.deliverer == goroutineID()
+	w.mu.Unlock()
+	if !fromFn {
+		<-w.stopped
+	}
+
+	return w.closeErr
+}
+
+// run reloads the file once it's gone without changes for the debounce
+// interval, until the watcher is closed
+func (w *Watcher) run() {
+	defer close(w.stopped)
+
+	debounce := time.NewTimer(w.opts.Debounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			debounce.Stop()
+			return
+		case <-w.notifier.changes():
+			debounce.Stop()
+			debounce = time.NewTimer(w.opts.Debounce)
+		case <-debounce.C:
+			w.reload()
+		}
+	}
+}
+
+// reload loads the file and delivers it if it parses and differs from the
+// last good document
+func (w *Watcher) reload() {
+	src, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		w.deliver(nil, nil, err)
+		return
+	}
+
+	w.mu.Lock()
+	old, oldSrc := w.doc, w.src
+	w.mu.Unlock()
+
+	if old != nil && bytes.Equal(src, oldSrc) {
+		return
+	}
+
+	doc, err := confl.ParseWithOptions(bytes.NewReader(src), w.opts.Parse)
+	if err != nil {
+		w.deliver(nil, nil, err)
+		return
+	}
+
+	changes := Diff(old, doc)
+	if old != nil && len(changes) == 0 {
+		w.mu.Lock()
+		w.src = src
+		w.mu.Unlock()
+		return
+	}
+
+	w.mu.Lock()
+	w.doc, w.src = doc, src
+	w.mu.Unlock()
+
+	if old == nil {
+		changes = nil
+	}
+	w.deliver(changes, doc, nil)
+}
+
+// deliver passes changes to the Changed option, if there are any, and then
+// doc or err to fn, unless the watcher has been closed
+func (w *Watcher) deliver(changes []Change, doc confl.Node, err error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.delivering = true
+	w.deliverer = goroutineID()
+	w.mu.Unlock()
+
+	defer func() {
+		w.mu.Lock()
+		w.delivering = false
+		w.mu.Unlock()
+	}()
+
+	if changes != nil && w.opts.Changed != nil {
+		w.opts.Changed(changes)
+	}
+	w.fn(doc, err)
+}
+
+// goroutineID returns the ID of the calling goroutine, from the first line of
+// its stack trace, like "goroutine 7 [running]:"
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = bytes.TrimPrefix(buf[:runtime.Stack(buf, false)], []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i >= 0 {
+		buf = buf[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
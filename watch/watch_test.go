@@ -0,0 +1,222 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nalanj/confl"
+	"github.com/stretchr/testify/assert"
+)
+
+// delivery is a single call to a watch function
+type delivery struct {
+	doc confl.Node
+	err error
+}
+
+// next returns the next delivery, failing the test if there isn't one soon
+func next(t *testing.T, deliveries chan delivery) delivery {
+	t.Helper()
+
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no document was delivered")
+		return delivery{}
+	}
+}
+
+// none fails the test if there's a delivery soon
+func none(t *testing.T, deliveries chan delivery) {
+	t.Helper()
+
+	select {
+	case d := <-deliveries:
+		t.Fatalf("unexpected delivery: %v %v", d.doc, d.err)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// host returns the value of the host key in doc
+func host(doc confl.Node) string {
+	for _, pair := range confl.KVPairs(doc) {
+		if pair.Key.Value() == "host" {
+			return pair.Value.Value()
+		}
+	}
+
+	return ""
+}
+
+func TestWatch(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		name := "notify"
+		if poll {
+			name = "poll"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "confl-watch")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "app.confl")
+			assert.Nil(t, ioutil.WriteFile(path, []byte("host=mail port=25"), 0644))
+
+			deliveries := make(chan delivery, 10)
+			changes := make(chan []Change, 10)
+			opts := Options{
+				Interval: 10 * time.Millisecond,
+				Debounce: 50 * time.Millisecond,
+				Poll:     poll,
+				Changed:  func(c []Change) { changes <- c },
+			}
+			w, err := WatchWithOptions(path, opts, func(doc confl.Node, err error) {
+				deliveries <- delivery{doc, err}
+			})
+			assert.Nil(t, err)
+			defer w.Close()
+
+			d := next(t, deliveries)
+			assert.Nil(t, d.err)
+			assert.Equal(t, "mail", host(d.doc))
+
+			// a burst of writes is delivered once
+			assert.Nil(t, ioutil.WriteFile(path, []byte("host=web port=25"), 0644))
+			assert.Nil(t, ioutil.WriteFile(path, []byte("host=web port=80"), 0644))
+			d = next(t, deliveries)
+			assert.Nil(t, d.err)
+			assert.Equal(t, "web", host(d.doc))
+			c := <-changes
+			assert.Equal(t, 2, len(c))
+			none(t, deliveries)
+
+			// errors keep the last good document
+			assert.Nil(t, ioutil.WriteFile(path, []byte("host=web port="), 0644))
+			d = next(t, deliveries)
+			assert.Nil(t, d.doc)
+			assert.Equal(t, path, d.err.(*confl.ParseError).Filename())
+			assert.Equal(t, "web", host(w.Node()))
+
+			// changes that don't change the document aren't delivered
+			time.Sleep(20 * time.Millisecond)
+			assert.Nil(t, ioutil.WriteFile(path, []byte("# web\nhost=web port=80"), 0644))
+			none(t, deliveries)
+
+			// replacing the file is noticed
+			tmp := filepath.Join(dir, "app.confl.tmp")
+			assert.Nil(t, ioutil.WriteFile(tmp, []byte("host=dc port=80"), 0644))
+			assert.Nil(t, os.Rename(tmp, path))
+			d = next(t, deliveries)
+			assert.Equal(t, "dc", host(d.doc))
+			assert.Equal(t, []Change{{Modified, "/host", c[0].New, d.doc.Children()[1]}}, <-changes)
+
+			assert.Nil(t, w.Close())
+			assert.Nil(t, w.Close())
+		})
+	}
+}
+
+func TestWatchMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confl-watch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.confl")
+	deliveries := make(chan delivery, 10)
+	w, err := WatchWithOptions(path, Options{Debounce: 10 * time.Millisecond}, func(doc confl.Node, err error) {
+		deliveries <- delivery{doc, err}
+	})
+	assert.Nil(t, err)
+	defer w.Close()
+
+	d := next(t, deliveries)
+	assert.True(t, os.IsNotExist(d.err))
+	assert.Nil(t, w.Node())
+
+	// the file is loaded once it's created
+	assert.Nil(t, ioutil.WriteFile(path, []byte("host=mail"), 0644))
+	d = next(t, deliveries)
+	assert.Nil(t, d.err)
+	assert.Equal(t, "mail", host(d.doc))
+}
+
+func TestWatchCloseFromFn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confl-watch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.confl")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("host=mail"), 0644))
+
+	var w *Watcher
+	ready := make(chan struct{})
+	closed := make(chan error, 10)
+	w, err = WatchWithOptions(path, Options{Debounce: 10 * time.Millisecond}, func(doc confl.Node, err error) {
+		if host(doc) == "web" {
+			<-ready
+			closed <- w.Close()
+		}
+	})
+	assert.Nil(t, err)
+	close(ready)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("host=web"), 0644))
+	select {
+	case err := <-closed:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close from fn didn't return")
+	}
+
+	// closing again, even at the same time, is safe
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() { done <- w.Close() }()
+	}
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, <-done)
+	}
+}
+
+func TestWatchCloseWaitsForFn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confl-watch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.confl")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("host=mail"), 0644))
+
+	started := make(chan struct{})
+	returned := make(chan struct{})
+	w, err := WatchWithOptions(path, Options{Debounce: 10 * time.Millisecond}, func(doc confl.Node, err error) {
+		if host(doc) == "web" {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			close(returned)
+		}
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("host=web"), 0644))
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no document was delivered")
+	}
+
+	// Close from another goroutine only returns once fn has
+	closed := make(chan error)
+	go func() { closed <- w.Close() }()
+	assert.Nil(t, <-closed)
+
+	select {
+	case <-returned:
+	default:
+		t.Fatal("Close returned while fn was running")
+	}
+}
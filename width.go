@@ -0,0 +1,67 @@
+package confl
+
+import (
+	"strings"
+	"unicode"
+)
+
+// defaultTabWidth is the number of columns between tab stops when rendering
+// code
+const defaultTabWidth = 4
+
+// wideRanges are the ranges of runes that are East Asian wide or fullwidth,
+// and take two columns in a terminal
+var wideRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x1100, Hi: 0x115f, Stride: 1},
+		{Lo: 0x2e80, Hi: 0x303e, Stride: 1},
+		{Lo: 0x3041, Hi: 0x33ff, Stride: 1},
+		{Lo: 0x3400, Hi: 0x4dbf, Stride: 1},
+		{Lo: 0x4e00, Hi: 0x9fff, Stride: 1},
+		{Lo: 0xa000, Hi: 0xa4cf, Stride: 1},
+		{Lo: 0xac00, Hi: 0xd7a3, Stride: 1},
+		{Lo: 0xf900, Hi: 0xfaff, Stride: 1},
+		{Lo: 0xfe30, Hi: 0xfe4f, Stride: 1},
+		{Lo: 0xff00, Hi: 0xff60, Stride: 1},
+		{Lo: 0xffe0, Hi: 0xffe6, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f300, Hi: 0x1f64f, Stride: 1},
+		{Lo: 0x1f900, Hi: 0x1f9ff, Stride: 1},
+		{Lo: 0x20000, Hi: 0x2fffd, Stride: 1},
+		{Lo: 0x30000, Hi: 0x3fffd, Stride: 1},
+	},
+}
+
+// runeWidth returns the number of columns a rune takes in a terminal
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case unicode.Is(wideRanges, r):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// expandTabs replaces the tabs in s with spaces, starting at column col, and
+// returns the result along with the number of columns it takes
+func expandTabs(s string, col, tabWidth int) (string, int) {
+	var b strings.Builder
+	width := 0
+
+	for _, r := range s {
+		if r == '\t' {
+			spaces := tabWidth - (col+width)%tabWidth
+			b.WriteString(strings.Repeat(" ", spaces))
+			width += spaces
+			continue
+		}
+
+		b.WriteRune(r)
+		width += runeWidth(r)
+	}
+
+	return b.String(), width
+}